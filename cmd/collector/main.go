@@ -3,7 +3,8 @@ package main
 import (
 	"log"
 
-	// Our custom processors
+	// Our custom extensions and processors
+	"github.com/newrelic/nrdot-process-optimization/extensions/explain"
 	"github.com/newrelic/nrdot-process-optimization/processors/adaptivetopk"
 	"github.com/newrelic/nrdot-process-optimization/processors/helloworld"
 	"github.com/newrelic/nrdot-process-optimization/processors/othersrollup"
@@ -12,6 +13,7 @@ import (
 
 	// OTel core
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/connector"
 	"go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/extension"
 	"go.opentelemetry.io/collector/otelcol"
@@ -63,6 +65,7 @@ func components() (otelcol.Factories, error) {
 		Receivers:  make(map[component.Type]receiver.Factory),
 		Processors: make(map[component.Type]processor.Factory),
 		Exporters:  make(map[component.Type]exporter.Factory),
+		Connectors: make(map[component.Type]connector.Factory),
 	}
 
 	// Add receivers
@@ -78,12 +81,16 @@ func components() (otelcol.Factories, error) {
 	factories.Processors[batchprocessor.NewFactory().Type()] = batchprocessor.NewFactory()
 	factories.Processors[memorylimiterprocessor.NewFactory().Type()] = memorylimiterprocessor.NewFactory()
 
+	// Add connectors
+	factories.Connectors[adaptivetopk.NewConnectorFactory().Type()] = adaptivetopk.NewConnectorFactory()
+
 	// Add exporters
 	factories.Exporters[prometheusexporter.NewFactory().Type()] = prometheusexporter.NewFactory()
 	factories.Exporters[otlphttpexporter.NewFactory().Type()] = otlphttpexporter.NewFactory()
 
 	// Add extensions
 	factories.Extensions[zpagesextension.NewFactory().Type()] = zpagesextension.NewFactory()
+	factories.Extensions[explain.NewFactory().Type()] = explain.NewFactory()
 
 	return factories, nil
 }
@@ -0,0 +1,41 @@
+package explain
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/confmap"
+)
+
+// Config defines the configuration for the explain extension.
+type Config struct {
+	// Endpoint is the address the debug pages are served on.
+	Endpoint string `mapstructure:"endpoint"`
+	// HistorySize is how many recent decisions are kept across all processors.
+	HistorySize int `mapstructure:"history_size"`
+}
+
+var _ component.Config = (*Config)(nil)
+var _ confmap.Unmarshaler = (*Config)(nil)
+
+func (cfg *Config) Validate() error {
+	if cfg.Endpoint == "" {
+		return errors.New("endpoint cannot be empty")
+	}
+	if cfg.HistorySize <= 0 {
+		return errors.New("history_size must be positive")
+	}
+	return nil
+}
+
+func (cfg *Config) Unmarshal(componentParser *confmap.Conf) error {
+	if componentParser == nil {
+		return nil
+	}
+
+	// Set default values
+	cfg.Endpoint = "localhost:55690"
+	cfg.HistorySize = 10000
+
+	return componentParser.Unmarshal(cfg)
+}
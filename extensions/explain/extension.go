@@ -0,0 +1,254 @@
+package explain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+	"go.uber.org/zap"
+)
+
+// Processor types whose latest decisions make up the top K and reservoir pages.
+const (
+	topKProcessorType      = "adaptivetopk"
+	reservoirProcessorType = "reservoirsampler"
+)
+
+type explainExtension struct {
+	config *Config
+	logger *zap.Logger
+	server *http.Server
+
+	mu      sync.Mutex
+	latest  map[component.ID][]decisions.Decision // Decisions of each processor's latest batch
+	history []decisions.Decision                  // Ring buffer of the last HistorySize decisions
+	next    int                                   // Next history slot to overwrite once full
+}
+
+var _ decisions.Recorder = (*explainExtension)(nil)
+
+func newExplainExtension(settings extension.CreateSettings, cfg *Config) *explainExtension {
+	return &explainExtension{
+		config:  cfg,
+		logger:  settings.Logger,
+		latest:  make(map[component.ID][]decisions.Decision),
+		history: make([]decisions.Decision, 0, cfg.HistorySize),
+	}
+}
+
+func (e *explainExtension) Start(_ context.Context, _ component.Host) error {
+	ln, err := net.Listen("tcp", e.config.Endpoint)
+	if err != nil {
+		return err
+	}
+	e.server = &http.Server{Handler: e.handler(), ReadHeaderTimeout: 20 * time.Second}
+	go func() {
+		if err := e.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.logger.Error("Explain extension server failed", zap.Error(err))
+		}
+	}()
+	e.logger.Info("Explain extension serving decision pages", zap.String("endpoint", e.config.Endpoint))
+	return nil
+}
+
+func (e *explainExtension) Shutdown(ctx context.Context) error {
+	if e.server == nil {
+		return nil
+	}
+	return e.server.Shutdown(ctx)
+}
+
+// RecordDecisions stores the decisions of a processor's batch, replacing its previous batch.
+func (e *explainExtension) RecordDecisions(processor component.ID, batch []decisions.Decision) {
+	now := time.Now()
+	stored := make([]decisions.Decision, len(batch))
+	for i, d := range batch {
+		d.Time = now
+		d.Processor = processor.String()
+		stored[i] = d
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.latest[processor] = stored
+	for _, d := range stored {
+		if len(e.history) < e.config.HistorySize {
+			e.history = append(e.history, d)
+			continue
+		}
+		e.history[e.next] = d
+		e.next = (e.next + 1) % e.config.HistorySize
+	}
+}
+
+// recent returns the decision history, newest first.
+func (e *explainExtension) recent() []decisions.Decision {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]decisions.Decision, 0, len(e.history))
+	for i := len(e.history) - 1; i >= 0; i-- {
+		out = append(out, e.history[(e.next+i)%len(e.history)])
+	}
+	return out
+}
+
+// latestOf returns the latest batch of every processor of the given type that passes keep,
+// ordered by processor and rank.
+func (e *explainExtension) latestOf(processorType component.Type, keep func(decisions.Decision) bool) []decisions.Decision {
+	e.mu.Lock()
+	var out []decisions.Decision
+	for id, batch := range e.latest {
+		if id.Type() != processorType {
+			continue
+		}
+		for _, d := range batch {
+			if keep(d) {
+				out = append(out, d)
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Processor != out[j].Processor {
+			return out[i].Processor < out[j].Processor
+		}
+		// Ranked decisions first, then by PID
+		if (out[i].Rank == 0) != (out[j].Rank == 0) {
+			return out[i].Rank != 0
+		}
+		if out[i].Rank != out[j].Rank {
+			return out[i].Rank < out[j].Rank
+		}
+		return out[i].PID < out[j].PID
+	})
+	return out
+}
+
+func (e *explainExtension) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/explain", e.handleIndex)
+	mux.HandleFunc("/debug/explain/decisions", e.handleDecisions)
+	mux.HandleFunc("/debug/explain/topk", e.handleTopK)
+	mux.HandleFunc("/debug/explain/reservoir", e.handleReservoir)
+	mux.HandleFunc("/debug/explain/process", e.handleProcess)
+	return mux
+}
+
+// page is what every page renders, as HTML or, with ?format=json, as JSON.
+type page struct {
+	Title       string               `json:"title"`
+	Description string               `json:"description"`
+	Decisions   []decisions.Decision `json:"decisions"`
+}
+
+func (e *explainExtension) handleIndex(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, nil); err != nil {
+		e.logger.Debug("Failed to render explain index", zap.Error(err))
+	}
+}
+
+func (e *explainExtension) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	e.render(w, r, page{
+		Title:       "Recent decisions",
+		Description: "The most recent decisions of every processor, newest first.",
+		Decisions:   e.recent(),
+	})
+}
+
+func (e *explainExtension) handleTopK(w http.ResponseWriter, r *http.Request) {
+	e.render(w, r, page{
+		Title:       "Current top K set",
+		Description: "Processes kept by the latest batch of each adaptivetopk processor.",
+		Decisions: e.latestOf(topKProcessorType, func(d decisions.Decision) bool {
+			return d.Outcome != decisions.OutcomeDropped
+		}),
+	})
+}
+
+func (e *explainExtension) handleReservoir(w http.ResponseWriter, r *http.Request) {
+	e.render(w, r, page{
+		Title:       "Reservoir contents",
+		Description: "Sampled processes in the latest batch of each reservoirsampler processor.",
+		Decisions: e.latestOf(reservoirProcessorType, func(d decisions.Decision) bool {
+			return d.Outcome == decisions.OutcomeSampled
+		}),
+	})
+}
+
+func (e *explainExtension) handleProcess(w http.ResponseWriter, r *http.Request) {
+	pid := r.URL.Query().Get("pid")
+	if pid == "" {
+		http.Error(w, "missing pid query parameter", http.StatusBadRequest)
+		return
+	}
+
+	var found []decisions.Decision
+	for _, d := range e.recent() {
+		if d.PID == pid {
+			found = append(found, d)
+		}
+	}
+	description := "Every recent decision about PID " + pid + ", newest first. " +
+		"The newest decision of each processor explains where its data points went."
+	if len(found) == 0 {
+		description = "No processor reported a decision about PID " + pid + " in the recent history. " +
+			"Check that the receiver reports the process and that the pipeline reaches the processors."
+	}
+	e.render(w, r, page{
+		Title:       "Why is PID " + pid + " missing?",
+		Description: description,
+		Decisions:   found,
+	})
+}
+
+func (e *explainExtension) render(w http.ResponseWriter, r *http.Request, p page) {
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p); err != nil {
+			e.logger.Debug("Failed to encode explain page", zap.Error(err))
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, p); err != nil {
+		e.logger.Debug("Failed to render explain page", zap.Error(err))
+	}
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><title>Process optimization decisions</title></head>
+<body>
+<h1>Process optimization decisions</h1>
+<ul>
+<li><a href="/debug/explain/topk">Current top K set</a></li>
+<li><a href="/debug/explain/reservoir">Reservoir contents</a></li>
+<li><a href="/debug/explain/decisions">Recent decisions</a></li>
+</ul>
+<form action="/debug/explain/process">Why is PID <input name="pid" size="8"> missing? <input type="submit" value="Explain"></form>
+<p>Append <code>?format=json</code> to any page for JSON.</p>
+</body></html>
+`))
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html><head><title>{{.Title}}</title></head>
+<body>
+<p><a href="/debug/explain">All pages</a></p>
+<h1>{{.Title}}</h1>
+<p>{{.Description}}</p>
+<table border="1" cellpadding="4">
+<tr><th>Time</th><th>Processor</th><th>PID</th><th>Outcome</th><th>Rank</th><th>Detail</th></tr>
+{{range .Decisions}}<tr><td>{{.Time.Format "15:04:05.000"}}</td><td>{{.Processor}}</td><td><a href="/debug/explain/process?pid={{.PID}}">{{.PID}}</a></td><td>{{.Outcome}}</td><td>{{if .Rank}}{{.Rank}}{{end}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
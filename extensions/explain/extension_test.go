@@ -0,0 +1,119 @@
+package explain
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/extension"
+	"go.uber.org/zap"
+)
+
+func newTestExtension(t *testing.T, historySize int) *explainExtension {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HistorySize = historySize
+	require.NoError(t, cfg.Validate())
+	return newExplainExtension(extension.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{Logger: zap.NewNop()},
+	}, cfg)
+}
+
+func getPage(t *testing.T, ext *explainExtension, url string) page {
+	rec := httptest.NewRecorder()
+	ext.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var p page
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+	return p
+}
+
+func pids(ds []decisions.Decision) []string {
+	out := make([]string, 0, len(ds))
+	for _, d := range ds {
+		out = append(out, d.PID)
+	}
+	return out
+}
+
+func TestExplainExtension_Pages(t *testing.T) {
+	ext := newTestExtension(t, 100)
+	topk := component.NewID("adaptivetopk")
+	sampler := component.NewID("reservoirsampler")
+
+	ext.RecordDecisions(topk, []decisions.Decision{
+		{PID: "1", Outcome: decisions.OutcomeCritical},
+		{PID: "3", Outcome: decisions.OutcomeTopK, Rank: 2},
+		{PID: "2", Outcome: decisions.OutcomeTopK, Rank: 1},
+		{PID: "4", Outcome: decisions.OutcomeDropped, Rank: 3},
+	})
+	ext.RecordDecisions(sampler, []decisions.Decision{
+		{PID: "4", Outcome: decisions.OutcomeNotSampled},
+		{PID: "5", Outcome: decisions.OutcomeSampled},
+	})
+
+	assert.Equal(t, []string{"2", "3", "1"}, pids(getPage(t, ext, "/debug/explain/topk?format=json").Decisions))
+	assert.Equal(t, []string{"5"}, pids(getPage(t, ext, "/debug/explain/reservoir?format=json").Decisions))
+
+	why := getPage(t, ext, "/debug/explain/process?pid=4&format=json")
+	require.Len(t, why.Decisions, 2)
+	assert.Equal(t, decisions.OutcomeNotSampled, why.Decisions[0].Outcome)
+	assert.Equal(t, "reservoirsampler", why.Decisions[0].Processor)
+	assert.Equal(t, decisions.OutcomeDropped, why.Decisions[1].Outcome)
+	assert.False(t, why.Decisions[0].Time.IsZero())
+
+	assert.Empty(t, getPage(t, ext, "/debug/explain/process?pid=42&format=json").Decisions)
+
+	// HTML pages render
+	for _, url := range []string{"/debug/explain", "/debug/explain/decisions", "/debug/explain/topk", "/debug/explain/process?pid=4"} {
+		rec := httptest.NewRecorder()
+		ext.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, url)
+		assert.Contains(t, rec.Header().Get("Content-Type"), "text/html", url)
+	}
+
+	rec := httptest.NewRecorder()
+	ext.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/explain/process", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestExplainExtension_BoundedHistory(t *testing.T) {
+	ext := newTestExtension(t, 3)
+	id := component.NewID("adaptivetopk")
+	for _, pid := range []string{"1", "2", "3", "4", "5"} {
+		ext.RecordDecisions(id, []decisions.Decision{{PID: pid, Outcome: decisions.OutcomeTopK}})
+	}
+
+	assert.Equal(t, []string{"5", "4", "3"}, pids(getPage(t, ext, "/debug/explain/decisions?format=json").Decisions))
+	// Only the latest batch makes up the current top K set
+	assert.Equal(t, []string{"5"}, pids(getPage(t, ext, "/debug/explain/topk?format=json").Decisions))
+}
+
+func TestExplainExtension_StartShutdown(t *testing.T) {
+	ext := newTestExtension(t, 10)
+	ext.config.Endpoint = "localhost:0"
+	require.NoError(t, ext.Start(context.Background(), componenttest.NewNopHost()))
+	assert.NoError(t, ext.Shutdown(context.Background()))
+
+	// Shutdown without Start is a no-op
+	assert.NoError(t, newTestExtension(t, 10).Shutdown(context.Background()))
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	assert.NoError(t, cfg.Validate())
+
+	cfg.HistorySize = 0
+	assert.EqualError(t, cfg.Validate(), "history_size must be positive")
+
+	cfg = createDefaultConfig().(*Config)
+	cfg.Endpoint = ""
+	assert.EqualError(t, cfg.Validate(), "endpoint cannot be empty")
+}
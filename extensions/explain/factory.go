@@ -0,0 +1,41 @@
+package explain
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension"
+)
+
+const (
+	typeStr   = "explain"
+	stability = component.StabilityLevelDevelopment
+)
+
+func NewFactory() extension.Factory {
+	return extension.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		createExtension,
+		stability,
+	)
+}
+
+func createDefaultConfig() component.Config {
+	return &Config{
+		Endpoint:    "localhost:55690",
+		HistorySize: 10000,
+	}
+}
+
+func createExtension(
+	_ context.Context,
+	set extension.CreateSettings,
+	cfg component.Config,
+) (extension.Extension, error) {
+	extensionCfg := cfg.(*Config)
+	if err := extensionCfg.Validate(); err != nil {
+		return nil, err
+	}
+	return newExplainExtension(set, extensionCfg), nil
+}
@@ -0,0 +1,228 @@
+// Package banding maps a continuous load signal to discrete operational values, such as
+// the K of the adaptivetopk processor, without flapping when the load hovers around a threshold.
+package banding
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// BelowLowestBand is the band index reported while the load is below every threshold.
+const BelowLowestBand = -1
+
+// bandFor returns the index of the highest threshold less than or equal to load,
+// or BelowLowestBand. thresholds must be sorted in ascending order.
+func bandFor(thresholds []float64, load float64) int {
+	return sort.Search(len(thresholds), func(i int) bool { return thresholds[i] > load }) - 1
+}
+
+// HysteresisController decides when the load may move the mapper to another band.
+// Moving up happens as soon as the load reaches a higher threshold; moving down requires
+// the load to fall DownMargin below the current band's threshold. In both directions the
+// current band must have been held for at least MinDwell.
+//
+// A HysteresisController is not safe for concurrent use on its own; LoadBandMapper
+// serializes access to it.
+type HysteresisController struct {
+	DownMargin float64
+	MinDwell   time.Duration
+
+	enteredAt time.Time
+}
+
+// NewHysteresisController creates a controller with the given down margin and minimum dwell time.
+func NewHysteresisController(downMargin float64, minDwell time.Duration) *HysteresisController {
+	return &HysteresisController{DownMargin: downMargin, MinDwell: minDwell}
+}
+
+// Enter records that a new band was entered at now.
+func (h *HysteresisController) Enter(now time.Time) {
+	h.enteredAt = now
+}
+
+// NextBand returns the band to use for load given the current band.
+func (h *HysteresisController) NextBand(thresholds []float64, current int, load float64, now time.Time) int {
+	target := bandFor(thresholds, load)
+	if target < current {
+		// Only move down as far as the load is clear of the margin
+		target = bandFor(thresholds, load+h.DownMargin)
+		if target > current {
+			target = current
+		}
+	}
+	if target == current || now.Sub(h.enteredAt) < h.MinDwell {
+		return current
+	}
+	h.Enter(now)
+	return target
+}
+
+// BandTransition moves a value towards its target by at most MaxStep per step.
+// A MaxStep of zero or less jumps straight to the target.
+type BandTransition struct {
+	MaxStep int
+}
+
+// NewBandTransition creates a transition limited to maxStep per step.
+func NewBandTransition(maxStep int) *BandTransition {
+	return &BandTransition{MaxStep: maxStep}
+}
+
+// Step returns the next value on the way from current to target.
+func (t *BandTransition) Step(current, target int) int {
+	if t.MaxStep <= 0 {
+		return target
+	}
+	switch {
+	case target > current+t.MaxStep:
+		return current + t.MaxStep
+	case target < current-t.MaxStep:
+		return current - t.MaxStep
+	default:
+		return target
+	}
+}
+
+// Option configures a LoadBandMapper.
+type Option func(*LoadBandMapper)
+
+// WithHysteresis sets the minimum time the mapper stays in a band before it may leave it.
+func WithHysteresis(minDwell time.Duration) Option {
+	return func(m *LoadBandMapper) { m.hysteresis.MinDwell = minDwell }
+}
+
+// WithDownMargin sets how far below a band's threshold the load must fall to leave it,
+// so that the down threshold is threshold-margin while the up threshold stays threshold.
+func WithDownMargin(margin float64) Option {
+	return func(m *LoadBandMapper) { m.hysteresis.DownMargin = margin }
+}
+
+// WithMaxStep limits how much the value may change per call.
+func WithMaxStep(step int) Option {
+	return func(m *LoadBandMapper) { m.transition.MaxStep = step }
+}
+
+// WithBounds clamps every returned value to [minValue, maxValue]. Below the lowest
+// threshold the mapper returns minValue.
+func WithBounds(minValue, maxValue int) Option {
+	return func(m *LoadBandMapper) {
+		m.minValue, m.maxValue, m.bounded = minValue, maxValue, true
+	}
+}
+
+// WithInitialValue sets the value the mapper starts from, so that WithMaxStep also
+// applies to the first call. Without it, the first call returns the band's value directly.
+func WithInitialValue(value int) Option {
+	return func(m *LoadBandMapper) {
+		m.currentValue, m.hasInitialValue = value, true
+	}
+}
+
+// WithClock replaces time.Now, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(m *LoadBandMapper) { m.now = now }
+}
+
+// LoadBandMapper maps host load to K values. Each threshold starts a band: the load falls in
+// the band of the highest threshold less than or equal to it. It is safe for concurrent use.
+type LoadBandMapper struct {
+	mu sync.Mutex
+
+	thresholds []float64 // Sorted ascending
+	values     []int     // values[i] is used from thresholds[i] up to thresholds[i+1]
+
+	minValue, maxValue int
+	bounded            bool
+
+	hysteresis *HysteresisController
+	transition *BandTransition
+	now        func() time.Time
+
+	initialized     bool
+	hasInitialValue bool
+	currentBand     int
+	currentValue    int
+}
+
+// NewLoadBandMapper creates a mapper from a map of load thresholds to values.
+func NewLoadBandMapper(bands map[float64]int, opts ...Option) *LoadBandMapper {
+	m := &LoadBandMapper{
+		thresholds:  make([]float64, 0, len(bands)),
+		values:      make([]int, 0, len(bands)),
+		hysteresis:  NewHysteresisController(0, 0),
+		transition:  NewBandTransition(0),
+		now:         time.Now,
+		currentBand: BelowLowestBand,
+	}
+	for threshold := range bands {
+		m.thresholds = append(m.thresholds, threshold)
+	}
+	sort.Float64s(m.thresholds)
+	for _, threshold := range m.thresholds {
+		m.values = append(m.values, bands[threshold])
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// GetKValueForLoad returns the value to use for the current load.
+func (m *LoadBandMapper) GetKValueForLoad(load float64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if !m.initialized {
+		m.initialized = true
+		m.currentBand = bandFor(m.thresholds, load)
+		m.hysteresis.Enter(now)
+		if !m.hasInitialValue {
+			m.currentValue = m.valueFor(m.currentBand)
+			return m.currentValue
+		}
+	} else {
+		m.currentBand = m.hysteresis.NextBand(m.thresholds, m.currentBand, load, now)
+	}
+	m.currentValue = m.clamp(m.transition.Step(m.currentValue, m.valueFor(m.currentBand)))
+	return m.currentValue
+}
+
+// GetBandBoundaries returns the configured thresholds in ascending order.
+func (m *LoadBandMapper) GetBandBoundaries() []float64 {
+	boundaries := make([]float64, len(m.thresholds))
+	copy(boundaries, m.thresholds)
+	return boundaries
+}
+
+// GetCurrentBand returns the index of the band the mapper is in, or BelowLowestBand.
+func (m *LoadBandMapper) GetCurrentBand() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.currentBand
+}
+
+// valueFor returns the bounded value of band.
+func (m *LoadBandMapper) valueFor(band int) int {
+	if band == BelowLowestBand {
+		if m.bounded || len(m.values) == 0 {
+			return m.minValue
+		}
+		return m.values[0]
+	}
+	return m.clamp(m.values[band])
+}
+
+func (m *LoadBandMapper) clamp(value int) int {
+	if !m.bounded {
+		return value
+	}
+	if value < m.minValue {
+		return m.minValue
+	}
+	if value > m.maxValue {
+		return m.maxValue
+	}
+	return value
+}
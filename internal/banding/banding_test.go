@@ -0,0 +1,124 @@
+package banding
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testBands = map[float64]int{
+	0.2: 5,
+	0.5: 10,
+	0.8: 20,
+}
+
+// fakeClock is a manually advanced clock for dwell time tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+func newFakeClock() *fakeClock               { return &fakeClock{now: time.Unix(1700000000, 0)} }
+
+func TestLoadBandMapper_HighestThresholdAtOrBelowLoad(t *testing.T) {
+	mapper := NewLoadBandMapper(testBands, WithBounds(3, 25))
+
+	assert.Equal(t, []float64{0.2, 0.5, 0.8}, mapper.GetBandBoundaries())
+
+	tests := []struct {
+		load  float64
+		value int
+		band  int
+	}{
+		{0.1, 3, BelowLowestBand}, // Below every threshold: the lower bound
+		{0.2, 5, 0},               // A load equal to a threshold is in that band
+		{0.47, 5, 0},
+		{0.5, 10, 1},
+		{0.79, 10, 1},
+		{0.95, 20, 2},
+		{0.3, 5, 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.value, mapper.GetKValueForLoad(tt.load), "load %.2f", tt.load)
+		assert.Equal(t, tt.band, mapper.GetCurrentBand(), "load %.2f", tt.load)
+	}
+}
+
+func TestLoadBandMapper_Bounds(t *testing.T) {
+	mapper := NewLoadBandMapper(testBands, WithBounds(8, 15))
+	assert.Equal(t, 8, mapper.GetKValueForLoad(0.3))
+	assert.Equal(t, 15, mapper.GetKValueForLoad(0.9))
+
+	unbounded := NewLoadBandMapper(testBands)
+	assert.Equal(t, 5, unbounded.GetKValueForLoad(0.1), "without bounds the lowest band's value is used")
+}
+
+func TestLoadBandMapper_DownMargin(t *testing.T) {
+	mapper := NewLoadBandMapper(testBands, WithDownMargin(0.1))
+
+	assert.Equal(t, 10, mapper.GetKValueForLoad(0.5))
+	// Hovering just below the threshold does not leave the band
+	assert.Equal(t, 10, mapper.GetKValueForLoad(0.45))
+	assert.Equal(t, 10, mapper.GetKValueForLoad(0.41))
+	// Up moves are not delayed by the margin
+	assert.Equal(t, 20, mapper.GetKValueForLoad(0.8))
+	// Falling past the margin moves down only as far as the margin allows
+	assert.Equal(t, 10, mapper.GetKValueForLoad(0.65))
+	assert.Equal(t, 5, mapper.GetKValueForLoad(0.35))
+}
+
+func TestLoadBandMapper_MinDwell(t *testing.T) {
+	clock := newFakeClock()
+	mapper := NewLoadBandMapper(testBands, WithHysteresis(30*time.Second), WithClock(clock.Now))
+
+	assert.Equal(t, 5, mapper.GetKValueForLoad(0.3))
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 5, mapper.GetKValueForLoad(0.9), "band changes wait for the dwell time")
+
+	clock.Advance(25 * time.Second)
+	assert.Equal(t, 20, mapper.GetKValueForLoad(0.9))
+
+	clock.Advance(10 * time.Second)
+	assert.Equal(t, 20, mapper.GetKValueForLoad(0.1), "the new band is held for the dwell time too")
+}
+
+func TestLoadBandMapper_MaxStep(t *testing.T) {
+	mapper := NewLoadBandMapper(testBands, WithBounds(3, 25), WithMaxStep(4), WithInitialValue(3))
+
+	assert.Equal(t, 7, mapper.GetKValueForLoad(0.9))
+	assert.Equal(t, 11, mapper.GetKValueForLoad(0.9))
+	assert.Equal(t, 15, mapper.GetKValueForLoad(0.9))
+	assert.Equal(t, 19, mapper.GetKValueForLoad(0.9))
+	assert.Equal(t, 20, mapper.GetKValueForLoad(0.9))
+	assert.Equal(t, 16, mapper.GetKValueForLoad(0.1))
+}
+
+func TestBandTransition_Step(t *testing.T) {
+	assert.Equal(t, 20, NewBandTransition(0).Step(5, 20))
+	assert.Equal(t, 8, NewBandTransition(3).Step(5, 20))
+	assert.Equal(t, 17, NewBandTransition(3).Step(20, 5))
+	assert.Equal(t, 6, NewBandTransition(3).Step(5, 6))
+}
+
+func TestLoadBandMapper_ConcurrentUse(t *testing.T) {
+	mapper := NewLoadBandMapper(testBands, WithBounds(3, 25), WithDownMargin(0.05), WithMaxStep(2))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				k := mapper.GetKValueForLoad(float64((w+i)%10) / 10)
+				assert.GreaterOrEqual(t, k, 3)
+				assert.LessOrEqual(t, k, 25)
+				mapper.GetCurrentBand()
+			}
+		}(w)
+	}
+	wg.Wait()
+}
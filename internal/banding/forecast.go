@@ -0,0 +1,64 @@
+package banding
+
+// HoltForecaster predicts the next value of a load series with Holt's linear trend method
+// (double exponential smoothing), so that a band can be entered before the load gets there.
+// Alpha smooths the level and Beta the trend; both are in (0, 1], higher reacting faster.
+//
+// A HoltForecaster is not safe for concurrent use.
+type HoltForecaster struct {
+	Alpha float64
+	Beta  float64
+
+	level        float64
+	trend        float64
+	observations int
+}
+
+// NewHoltForecaster creates a forecaster with the given level and trend smoothing factors.
+func NewHoltForecaster(alpha, beta float64) *HoltForecaster {
+	return &HoltForecaster{Alpha: alpha, Beta: beta}
+}
+
+// Observe adds the next value of the series. It returns the error of the forecast made for
+// this value (observed minus forecast), and false while there was no forecast yet.
+func (f *HoltForecaster) Observe(value float64) (forecastError float64, ok bool) {
+	switch f.observations {
+	case 0:
+		f.level = value
+	case 1:
+		forecastError, ok = value-f.Forecast(), true
+		f.trend = value - f.level
+		f.level = value
+	default:
+		forecastError, ok = value-f.Forecast(), true
+		previousLevel := f.level
+		f.level = f.Alpha*value + (1-f.Alpha)*(f.level+f.trend)
+		f.trend = f.Beta*(f.level-previousLevel) + (1-f.Beta)*f.trend
+	}
+	f.observations++
+	return forecastError, ok
+}
+
+// HoltState is the smoothed state of a HoltForecaster, to carry it across restarts.
+type HoltState struct {
+	Level        float64
+	Trend        float64
+	Observations int
+}
+
+// State returns the forecaster's smoothed state.
+func (f *HoltForecaster) State() HoltState {
+	return HoltState{Level: f.level, Trend: f.trend, Observations: f.observations}
+}
+
+// Restore replaces the forecaster's smoothed state, keeping its smoothing factors.
+func (f *HoltForecaster) Restore(s HoltState) {
+	f.level = s.Level
+	f.trend = s.Trend
+	f.observations = s.Observations
+}
+
+// Forecast returns the predicted next value, or the last value while the trend is unknown.
+func (f *HoltForecaster) Forecast() float64 {
+	return f.level + f.trend
+}
@@ -0,0 +1,55 @@
+package banding
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHoltForecaster_FollowsTrend(t *testing.T) {
+	f := NewHoltForecaster(0.5, 0.3)
+
+	_, ok := f.Observe(0.1)
+	assert.False(t, ok, "no forecast before the first value")
+	assert.InDelta(t, 0.1, f.Forecast(), 1e-9)
+
+	forecastErr, ok := f.Observe(0.2)
+	assert.True(t, ok)
+	assert.InDelta(t, 0.1, forecastErr, 1e-9)
+	assert.InDelta(t, 0.3, f.Forecast(), 1e-9, "a rising load is forecast to keep rising")
+
+	// A perfectly linear series is forecast without error
+	for _, v := range []float64{0.3, 0.4, 0.5} {
+		forecastErr, _ = f.Observe(v)
+		assert.InDelta(t, 0, forecastErr, 1e-9)
+	}
+	assert.InDelta(t, 0.6, f.Forecast(), 1e-9)
+
+	// A sudden drop shows up as a negative error and bends the trend down
+	forecastErr, _ = f.Observe(0.2)
+	assert.InDelta(t, -0.4, forecastErr, 1e-9)
+	assert.Less(t, f.Forecast(), 0.6)
+}
+
+func TestHoltForecaster_Restore(t *testing.T) {
+	f := NewHoltForecaster(0.5, 0.3)
+	for _, v := range []float64{0.1, 0.2, 0.3} {
+		f.Observe(v)
+	}
+
+	// A restored forecaster continues the trend instead of starting over
+	restored := NewHoltForecaster(0.5, 0.3)
+	restored.Restore(f.State())
+	assert.Equal(t, f.State(), restored.State())
+	forecastErr, ok := restored.Observe(0.4)
+	assert.True(t, ok)
+	assert.InDelta(t, 0, forecastErr, 1e-9)
+}
+
+func TestHoltForecaster_FlatLoad(t *testing.T) {
+	f := NewHoltForecaster(0.8, 0.2)
+	for i := 0; i < 5; i++ {
+		f.Observe(0.5)
+	}
+	assert.InDelta(t, 0.5, f.Forecast(), 1e-9)
+}
@@ -0,0 +1,51 @@
+// Package decisions lets the optimization processors report why they kept, dropped, sampled or
+// rolled up each process, for the explain extension to show.
+package decisions
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+)
+
+// Outcomes reported by the processors.
+const (
+	OutcomeCritical   = "critical"    // Tagged critical, or kept because it is critical
+	OutcomeTopK       = "topk"        // Selected by its rank in the top K
+	OutcomeMover      = "mover"       // Selected as one of the biggest movers
+	OutcomeHysteresis = "hysteresis"  // Kept only by hysteresis after leaving the top K
+	OutcomeDropped    = "dropped"     // Dropped by adaptivetopk
+	OutcomeSampled    = "sampled"     // In the reservoir
+	OutcomeNotSampled = "not_sampled" // Eligible for the reservoir but not in it
+	OutcomeRolledUp   = "rolled_up"   // Aggregated into the "other" series
+)
+
+// Decision is what a processor decided for one process in one batch.
+type Decision struct {
+	Time      time.Time `json:"time"`      // Set by the Recorder
+	Processor string    `json:"processor"` // Set by the Recorder
+	PID       string    `json:"pid"`
+	Outcome   string    `json:"outcome"`
+	Rank      int       `json:"rank,omitempty"` // 1-based top K rank, when known
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// Recorder receives the decisions a processor made for a batch. Implementations must be safe
+// for concurrent use and must not keep the slice after returning.
+type Recorder interface {
+	RecordDecisions(processor component.ID, decisions []Decision)
+}
+
+// FindRecorder returns an extension of host that implements Recorder, or nil when
+// there is none, in which case processors skip building decisions altogether.
+func FindRecorder(host component.Host) Recorder {
+	if host == nil {
+		return nil
+	}
+	for _, ext := range host.GetExtensions() {
+		if recorder, ok := ext.(Recorder); ok {
+			return recorder
+		}
+	}
+	return nil
+}
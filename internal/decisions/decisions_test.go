@@ -0,0 +1,44 @@
+package decisions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+)
+
+// nopExtension is an extension that does not record decisions.
+type nopExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+}
+
+type stubRecorder struct {
+	component.StartFunc
+	component.ShutdownFunc
+}
+
+func (stubRecorder) RecordDecisions(component.ID, []Decision) {}
+
+type extensionsHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h extensionsHost) GetExtensions() map[component.ID]component.Component { return h.extensions }
+
+func TestFindRecorder(t *testing.T) {
+	assert.Nil(t, FindRecorder(nil))
+	assert.Nil(t, FindRecorder(componenttest.NewNopHost()))
+
+	recorder := &stubRecorder{}
+	host := extensionsHost{
+		Host: componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{
+			component.NewID("zpages"):  &nopExtension{},
+			component.NewID("explain"): recorder,
+		},
+	}
+	assert.Same(t, recorder, FindRecorder(host))
+}
@@ -0,0 +1,19 @@
+package metricsutil
+
+import "go.opentelemetry.io/collector/pdata/pcommon"
+
+// Attributes looks up the attributes of one data point, falling back to those of its resource.
+// Receivers differ in where they put process attributes: the hostmetrics process scraper puts
+// process.pid and process.executable.name on the resource, others put them on every data point.
+type Attributes struct {
+	Point    pcommon.Map // The data point's own attributes, where processors add theirs
+	Resource pcommon.Map // The attributes of the resource the data point belongs to
+}
+
+// Get returns the data point's attribute key, or the resource's when the data point has none.
+func (a Attributes) Get(key string) (pcommon.Value, bool) {
+	if val, ok := a.Point.Get(key); ok {
+		return val, true
+	}
+	return a.Resource.Get(key)
+}
@@ -0,0 +1,66 @@
+package metricsutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// hostmetricsProcessFixture builds a batch shaped like the hostmetrics process scraper's output:
+// one resource per process carrying process.pid and process.executable.name, and data points
+// carrying only metric attributes such as state.
+func hostmetricsProcessFixture() pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutInt(ProcessPIDKey, 1234)
+	rm.Resource().Attributes().PutStr(ProcessExecutableNameKey, "nginx")
+	cpu := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	cpu.SetName("process.cpu.utilization")
+	dps := cpu.SetEmptyGauge().DataPoints()
+	for _, state := range []string{"user", "system"} {
+		dp := dps.AppendEmpty()
+		dp.Attributes().PutStr("state", state)
+		dp.SetDoubleValue(0.25)
+	}
+	return md
+}
+
+func TestAttributes_Get(t *testing.T) {
+	md := hostmetricsProcessFixture()
+	rm := md.ResourceMetrics().At(0)
+	dp := rm.ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().At(0)
+	attrs := Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()}
+
+	pid, ok := attrs.Get(ProcessPIDKey)
+	assert.True(t, ok, "process.pid should be found on the resource")
+	assert.Equal(t, "1234", pid.AsString())
+
+	state, ok := attrs.Get("state")
+	assert.True(t, ok)
+	assert.Equal(t, "user", state.Str())
+
+	// The data point's own attribute wins over the resource's
+	dp.Attributes().PutStr(ProcessExecutableNameKey, "nginx: worker")
+	exe, _ := attrs.Get(ProcessExecutableNameKey)
+	assert.Equal(t, "nginx: worker", exe.Str())
+
+	_, ok = attrs.Get("missing")
+	assert.False(t, ok)
+}
+
+func TestRangePointAttributes_ResourceAttributes(t *testing.T) {
+	md := hostmetricsProcessFixture()
+	pids := map[string]int{}
+	RangePointAttributes(md, func(_ pmetric.Metric, attrs Attributes) {
+		pid, _ := attrs.Get(ProcessPIDKey)
+		pids[pid.AsString()]++
+	})
+	assert.Equal(t, map[string]int{"1234": 2}, pids)
+
+	RemovePointsIf(md, func(_ pmetric.Metric, attrs Attributes) bool {
+		pid, ok := attrs.Get(ProcessPIDKey)
+		return ok && pid.AsString() == "1234"
+	})
+	assert.Equal(t, 0, md.ResourceMetrics().Len())
+}
@@ -0,0 +1,150 @@
+package metricsutil
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Attribute keys that identify a process.
+const (
+	ProcessPIDKey            = "process.pid"
+	ProcessCreateTimeKey     = "process.create_time"
+	ProcessExecutableNameKey = "process.executable.name"
+	ProcessExecutablePathKey = "process.executable.path"
+)
+
+// ProcessIdentity returns a key for one process instance, combining its PID with its start time
+// and a hash of its executable. A reused PID belongs to a process started later, so it gets a new
+// identity. Attributes are looked up on the data point, then on its resource.
+//
+// The start time is the process.create_time attribute. The executable is its path or, failing
+// that, its name. When neither is known the identity is the PID alone. ok is false when attrs has
+// no PID. ProcessIdentities resolves the identity of a whole batch consistently instead.
+func ProcessIdentity(attrs Attributes) (identity string, ok bool) {
+	pid, found := attrs.Get(ProcessPIDKey)
+	if !found {
+		return "", false
+	}
+	parts := identityParts{pid: pid.AsString()}
+	parts.collect(attrs)
+	return parts.identity(), true
+}
+
+// ProcessIdentities maps each PID of a batch to its process identity.
+type ProcessIdentities map[string]string
+
+// ResolveProcessIdentities resolves the identity of every PID in md once, so that all data points
+// of a process share one identity even when only some of them carry the identifying attributes.
+// Within one batch a PID belongs to a single process. Each part of the identity comes from the
+// first data point or resource of the PID that has it. The start time is process.create_time or,
+// as the hostmetrics receiver does not report it, the start timestamp of a cumulative sum.
+func ResolveProcessIdentities(md pmetric.Metrics) ProcessIdentities {
+	parts := make(map[string]*identityParts)
+	partsOf := func(attrs Attributes) *identityParts {
+		pid, found := attrs.Get(ProcessPIDKey)
+		if !found {
+			return nil
+		}
+		p, ok := parts[pid.AsString()]
+		if !ok {
+			p = &identityParts{pid: pid.AsString()}
+			parts[p.pid] = p
+		}
+		return p
+	}
+	RangePointAttributes(md, func(_ pmetric.Metric, attrs Attributes) {
+		if p := partsOf(attrs); p != nil {
+			p.collect(attrs)
+		}
+	})
+
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			sm := rm.ScopeMetrics().At(j)
+			for k := 0; k < sm.Metrics().Len(); k++ {
+				metric := sm.Metrics().At(k)
+				if metric.Type() != pmetric.MetricTypeSum || metric.Sum().AggregationTemporality() != pmetric.AggregationTemporalityCumulative {
+					continue
+				}
+				dps := metric.Sum().DataPoints()
+				for l := 0; l < dps.Len(); l++ {
+					dp := dps.At(l)
+					p := partsOf(Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()})
+					if p != nil && p.started == 0 {
+						p.started = dp.StartTimestamp()
+					}
+				}
+			}
+		}
+	}
+
+	ids := make(ProcessIdentities, len(parts))
+	for pid, p := range parts {
+		ids[pid] = p.identity()
+	}
+	return ids
+}
+
+// Get returns the identity of the process a data point belongs to. Data points of PIDs the batch
+// did not resolve fall back to ProcessIdentity. ok is false when attrs has no PID.
+func (ids ProcessIdentities) Get(attrs Attributes) (identity string, ok bool) {
+	pid, found := attrs.Get(ProcessPIDKey)
+	if !found {
+		return "", false
+	}
+	if identity, resolved := ids[pid.AsString()]; resolved {
+		return identity, true
+	}
+	return ProcessIdentity(attrs)
+}
+
+// identityParts holds the identifying attributes of a process. Empty strings are unknown.
+type identityParts struct {
+	pid            string
+	createTime     string
+	executablePath string
+	executableName string
+	started        pcommon.Timestamp // Start timestamp of a cumulative sum, 0 if unknown
+}
+
+// collect fills in the parts still unknown from attrs.
+func (p *identityParts) collect(attrs Attributes) {
+	fill := func(part *string, key string) {
+		if *part != "" {
+			return
+		}
+		if val, found := attrs.Get(key); found {
+			*part = val.AsString()
+		}
+	}
+	fill(&p.createTime, ProcessCreateTimeKey)
+	fill(&p.executablePath, ProcessExecutablePathKey)
+	fill(&p.executableName, ProcessExecutableNameKey)
+}
+
+// identity joins the PID with the start time and a hash of the executable.
+func (p *identityParts) identity() string {
+	started := p.createTime
+	if started == "" && p.started != 0 {
+		started = strconv.FormatUint(uint64(p.started), 10)
+	}
+
+	executable := p.executablePath
+	if executable == "" {
+		executable = p.executableName
+	}
+	if executable != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(executable))
+		executable = strconv.FormatUint(uint64(h.Sum32()), 16)
+	}
+
+	if started == "" && executable == "" {
+		return p.pid
+	}
+	return p.pid + "@" + started + "#" + executable
+}
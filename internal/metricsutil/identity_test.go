@@ -0,0 +1,94 @@
+package metricsutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestProcessIdentity(t *testing.T) {
+	attrs := func(kv map[string]any) Attributes {
+		m := pcommon.NewMap()
+		assert.NoError(t, m.FromRaw(kv))
+		return Attributes{Point: m, Resource: pcommon.NewMap()}
+	}
+
+	_, ok := ProcessIdentity(attrs(map[string]any{ProcessExecutableNameKey: "nginx"}))
+	assert.False(t, ok)
+
+	// Without a start time or executable the identity is the PID alone
+	id, ok := ProcessIdentity(attrs(map[string]any{ProcessPIDKey: 42}))
+	assert.True(t, ok)
+	assert.Equal(t, "42", id)
+
+	nginx := attrs(map[string]any{ProcessPIDKey: "42", ProcessExecutableNameKey: "nginx"})
+	first, _ := ProcessIdentity(nginx)
+	again, _ := ProcessIdentity(nginx)
+	assert.Equal(t, first, again)
+
+	// The same PID reused by a later process, or by another executable, is a new identity
+	created := attrs(map[string]any{ProcessPIDKey: "42", ProcessExecutableNameKey: "nginx", ProcessCreateTimeKey: "2024-01-01T00:00:00Z"})
+	restarted := attrs(map[string]any{ProcessPIDKey: "42", ProcessExecutableNameKey: "nginx", ProcessCreateTimeKey: "2024-01-02T00:00:00Z"})
+	a, _ := ProcessIdentity(created)
+	b, _ := ProcessIdentity(restarted)
+	assert.NotEqual(t, a, b)
+	other, _ := ProcessIdentity(attrs(map[string]any{ProcessPIDKey: "42", ProcessExecutableNameKey: "java"}))
+	assert.NotEqual(t, first, other)
+
+	// The executable path takes precedence over its name
+	byPath, _ := ProcessIdentity(attrs(map[string]any{ProcessPIDKey: "42", ProcessExecutablePathKey: "/usr/sbin/nginx", ProcessExecutableNameKey: "nginx"}))
+	byOtherName, _ := ProcessIdentity(attrs(map[string]any{ProcessPIDKey: "42", ProcessExecutablePathKey: "/usr/sbin/nginx", ProcessExecutableNameKey: "renamed"}))
+	assert.Equal(t, byPath, byOtherName)
+
+	// Resource attributes identify the process too, as with the hostmetrics process scraper
+	resource := pcommon.NewMap()
+	resource.PutInt(ProcessPIDKey, 42)
+	resource.PutStr(ProcessExecutableNameKey, "nginx")
+	fromResource, ok := ProcessIdentity(Attributes{Point: pcommon.NewMap(), Resource: resource})
+	assert.True(t, ok)
+	assert.Equal(t, first, fromResource)
+}
+
+func TestResolveProcessIdentities(t *testing.T) {
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+
+	// The gauge carries only the PID, the cumulative sum the executable and its start timestamp
+	cpu := sm.Metrics().AppendEmpty()
+	cpu.SetName("process.cpu.utilization")
+	gaugePoint := cpu.SetEmptyGauge().DataPoints().AppendEmpty()
+	gaugePoint.Attributes().PutStr(ProcessPIDKey, "42")
+	cpuTime := sm.Metrics().AppendEmpty()
+	cpuTime.SetName("process.cpu.time")
+	cpuTime.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	sumPoint := cpuTime.Sum().DataPoints().AppendEmpty()
+	sumPoint.Attributes().PutStr(ProcessPIDKey, "42")
+	sumPoint.Attributes().PutStr(ProcessExecutableNameKey, "nginx")
+	sumPoint.SetStartTimestamp(pcommon.Timestamp(1_000))
+
+	ids := ResolveProcessIdentities(md)
+	fromGauge, ok := ids.Get(Attributes{Point: gaugePoint.Attributes(), Resource: pcommon.NewMap()})
+	assert.True(t, ok)
+	fromSum, _ := ids.Get(Attributes{Point: sumPoint.Attributes(), Resource: pcommon.NewMap()})
+	assert.Equal(t, fromSum, fromGauge, "Every data point of a process shares one identity")
+
+	// The sum's start timestamp tells a restarted process apart
+	sumPoint.SetStartTimestamp(pcommon.Timestamp(2_000))
+	restarted, _ := ResolveProcessIdentities(md).Get(Attributes{Point: gaugePoint.Attributes(), Resource: pcommon.NewMap()})
+	assert.NotEqual(t, fromGauge, restarted)
+
+	// process.create_time takes precedence over the start timestamp
+	gaugePoint.Attributes().PutStr(ProcessCreateTimeKey, "2024-01-01T00:00:00Z")
+	created, _ := ResolveProcessIdentities(md).Get(Attributes{Point: sumPoint.Attributes(), Resource: pcommon.NewMap()})
+	byCreateTime, _ := ProcessIdentity(Attributes{Point: gaugePoint.Attributes(), Resource: sumPoint.Attributes()})
+	assert.Equal(t, byCreateTime, created)
+
+	// PIDs not in the batch fall back to the data point's own attributes
+	other := pcommon.NewMap()
+	other.PutStr(ProcessPIDKey, "7")
+	id, ok := ids.Get(Attributes{Point: other, Resource: pcommon.NewMap()})
+	assert.True(t, ok)
+	assert.Equal(t, "7", id)
+}
@@ -1,6 +1,8 @@
 package metricsutil
 
-import "go.opentelemetry.io/collector/pdata/pmetric"
+import (
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
 
 // CountPoints counts the total number of data points contained in a Metrics collection.
 func CountPoints(md pmetric.Metrics) int {
@@ -28,3 +30,89 @@ func CountPoints(md pmetric.Metrics) int {
 	}
 	return count
 }
+
+// RangePointAttributes calls fn with the attributes of every data point, whatever the metric type,
+// and the metric it belongs to.
+func RangePointAttributes(md pmetric.Metrics, fn func(metric pmetric.Metric, attrs Attributes)) {
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		resource := rm.Resource().Attributes()
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			sm := rm.ScopeMetrics().At(j)
+			for k := 0; k < sm.Metrics().Len(); k++ {
+				metric := sm.Metrics().At(k)
+				switch metric.Type() {
+				case pmetric.MetricTypeGauge:
+					dps := metric.Gauge().DataPoints()
+					for l := 0; l < dps.Len(); l++ {
+						fn(metric, Attributes{Point: dps.At(l).Attributes(), Resource: resource})
+					}
+				case pmetric.MetricTypeSum:
+					dps := metric.Sum().DataPoints()
+					for l := 0; l < dps.Len(); l++ {
+						fn(metric, Attributes{Point: dps.At(l).Attributes(), Resource: resource})
+					}
+				case pmetric.MetricTypeHistogram:
+					dps := metric.Histogram().DataPoints()
+					for l := 0; l < dps.Len(); l++ {
+						fn(metric, Attributes{Point: dps.At(l).Attributes(), Resource: resource})
+					}
+				case pmetric.MetricTypeSummary:
+					dps := metric.Summary().DataPoints()
+					for l := 0; l < dps.Len(); l++ {
+						fn(metric, Attributes{Point: dps.At(l).Attributes(), Resource: resource})
+					}
+				case pmetric.MetricTypeExponentialHistogram:
+					dps := metric.ExponentialHistogram().DataPoints()
+					for l := 0; l < dps.Len(); l++ {
+						fn(metric, Attributes{Point: dps.At(l).Attributes(), Resource: resource})
+					}
+				}
+			}
+		}
+	}
+}
+
+// RemovePointsIf removes every data point, whatever the metric type, for which remove returns true
+// given the point's attributes and the metric it belongs to.
+// Metrics, scopes and resources left without data points are removed as well.
+func RemovePointsIf(md pmetric.Metrics, remove func(metric pmetric.Metric, attrs Attributes) bool) {
+	md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+		resource := rm.Resource().Attributes()
+		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
+			sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
+				switch metric.Type() {
+				case pmetric.MetricTypeGauge:
+					metric.Gauge().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+						return remove(metric, Attributes{Point: dp.Attributes(), Resource: resource})
+					})
+					return metric.Gauge().DataPoints().Len() == 0
+				case pmetric.MetricTypeSum:
+					metric.Sum().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
+						return remove(metric, Attributes{Point: dp.Attributes(), Resource: resource})
+					})
+					return metric.Sum().DataPoints().Len() == 0
+				case pmetric.MetricTypeHistogram:
+					metric.Histogram().DataPoints().RemoveIf(func(dp pmetric.HistogramDataPoint) bool {
+						return remove(metric, Attributes{Point: dp.Attributes(), Resource: resource})
+					})
+					return metric.Histogram().DataPoints().Len() == 0
+				case pmetric.MetricTypeSummary:
+					metric.Summary().DataPoints().RemoveIf(func(dp pmetric.SummaryDataPoint) bool {
+						return remove(metric, Attributes{Point: dp.Attributes(), Resource: resource})
+					})
+					return metric.Summary().DataPoints().Len() == 0
+				case pmetric.MetricTypeExponentialHistogram:
+					metric.ExponentialHistogram().DataPoints().RemoveIf(func(dp pmetric.ExponentialHistogramDataPoint) bool {
+						return remove(metric, Attributes{Point: dp.Attributes(), Resource: resource})
+					})
+					return metric.ExponentialHistogram().DataPoints().Len() == 0
+				default:
+					return false
+				}
+			})
+			return sm.Metrics().Len() == 0
+		})
+		return rm.ScopeMetrics().Len() == 0
+	})
+}
@@ -39,3 +39,39 @@ func TestCountPoints(t *testing.T) {
 	// Ensure total count is 6
 	assert.Equal(t, 6, CountPoints(md))
 }
+
+// TestRemovePointsIf verifies that data points of every metric type are filtered
+// and that emptied metrics, scopes and resources are removed.
+func TestRemovePointsIf(t *testing.T) {
+	md := pmetric.NewMetrics()
+
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	for _, pid := range []string{"keep", "drop"} {
+		sm.Metrics().AppendEmpty().SetEmptyGauge().DataPoints().AppendEmpty().Attributes().PutStr("pid", pid)
+		sm.Metrics().AppendEmpty().SetEmptySum().DataPoints().AppendEmpty().Attributes().PutStr("pid", pid)
+		sm.Metrics().AppendEmpty().SetEmptyHistogram().DataPoints().AppendEmpty().Attributes().PutStr("pid", pid)
+		sm.Metrics().AppendEmpty().SetEmptySummary().DataPoints().AppendEmpty().Attributes().PutStr("pid", pid)
+		sm.Metrics().AppendEmpty().SetEmptyExponentialHistogram().DataPoints().AppendEmpty().Attributes().PutStr("pid", pid)
+	}
+
+	// A second resource whose only data point is removed
+	dropOnly := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	dropOnly.SetEmptyHistogram().DataPoints().AppendEmpty().Attributes().PutStr("pid", "drop")
+
+	RemovePointsIf(md, func(_ pmetric.Metric, attrs Attributes) bool {
+		pid, _ := attrs.Get("pid")
+		return pid.Str() == "drop"
+	})
+
+	assert.Equal(t, 5, CountPoints(md))
+	assert.Equal(t, 1, md.ResourceMetrics().Len(), "Emptied resource should be removed")
+	assert.Equal(t, 5, md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().Len(), "Emptied metrics should be removed")
+
+	seen := 0
+	RangePointAttributes(md, func(_ pmetric.Metric, attrs Attributes) {
+		pid, _ := attrs.Get("pid")
+		assert.Equal(t, "keep", pid.Str())
+		seen++
+	})
+	assert.Equal(t, 5, seen)
+}
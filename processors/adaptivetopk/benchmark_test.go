@@ -122,6 +122,15 @@ func BenchmarkAdaptiveTopKProcessor(b *testing.B) {
 			hasHysteresis:  true,
 			hasCritical:    true,
 		},
+		{
+			name:           "XLarge-10k-Static-WithCritical",
+			numProcesses:   10000,
+			metricsPerProc: 3,
+			kValue:         20,
+			isDynamicK:     false,
+			hasHysteresis:  false,
+			hasCritical:    true,
+		},
 	}
 
 	ctx := context.Background()
@@ -158,9 +167,13 @@ func BenchmarkAdaptiveTopKProcessor(b *testing.B) {
 			md := generateTestMetrics(tt.numProcesses, tt.metricsPerProc, tt.hasCritical)
 
 			// Reset timer for the actual benchmark
+			b.ReportAllocs()
 			b.ResetTimer()
 
 			for i := 0; i < b.N; i++ {
+				// Keep setup out of the measured time and allocations
+				b.StopTimer()
+
 				// Create a new processor for each iteration to avoid state contamination
 				nextSink := new(consumertest.MetricsSink)
 				settings := processor.CreateSettings{
@@ -178,6 +191,7 @@ func BenchmarkAdaptiveTopKProcessor(b *testing.B) {
 				// Clone the metrics to avoid modifying the original
 				mdClone := pmetric.NewMetrics()
 				md.CopyTo(mdClone)
+				b.StartTimer()
 
 				// Run the processor
 				err = proc.ConsumeMetrics(ctx, mdClone)
@@ -187,6 +201,47 @@ func BenchmarkAdaptiveTopKProcessor(b *testing.B) {
 	}
 }
 
+// BenchmarkAdaptiveTopKProcessorParallel benchmarks concurrent ConsumeMetrics calls
+// on a single processor, which share the dynamic K and hysteresis state.
+func BenchmarkAdaptiveTopKProcessorParallel(b *testing.B) {
+	cfg := &Config{
+		KeyMetricName:          "process.cpu.utilization",
+		SecondaryKeyMetricName: "process.memory.rss",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+		HostLoadMetricName:     "system.cpu.utilization",
+		LoadBandsToKMap:        map[float64]int{0.3: 10, 0.6: 20, 0.9: 30},
+		MinKValue:              5,
+		MaxKValue:              30,
+		HysteresisDuration:     30 * time.Second,
+	}
+	require.NoError(b, cfg.Validate())
+
+	settings := processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{},
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	proc, err := newAdaptiveTopKProcessor(settings, consumertest.NewNop(), cfg)
+	require.NoError(b, err)
+
+	md := generateTestMetrics(500, 3, true)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			// Clone the metrics to avoid modifying the shared original
+			mdClone := pmetric.NewMetrics()
+			md.CopyTo(mdClone)
+			if err := proc.ConsumeMetrics(ctx, mdClone); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
 // BenchmarkFindHostLoadMetric benchmarks the findHostLoadMetric function
 func BenchmarkFindHostLoadMetric(b *testing.B) {
 	proc := &adaptiveTopKProcessor{
@@ -254,19 +309,19 @@ func BenchmarkEstimateProcessCount(b *testing.B) {
 
 	b.Run("SmallMetrics", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			estimateProcessCount(smallMetrics)
+			estimateProcessCount(smallMetrics, processPIDKey)
 		}
 	})
 
 	b.Run("MediumMetrics", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			estimateProcessCount(mediumMetrics)
+			estimateProcessCount(mediumMetrics, processPIDKey)
 		}
 	})
 
 	b.Run("LargeMetrics", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			estimateProcessCount(largeMetrics)
+			estimateProcessCount(largeMetrics, processPIDKey)
 		}
 	})
 }
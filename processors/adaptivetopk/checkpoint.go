@@ -0,0 +1,195 @@
+package adaptivetopk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/newrelic/nrdot-process-optimization/internal/banding"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.uber.org/zap"
+)
+
+// checkpointKey is the storage key of the processor's state.
+const checkpointKey = "adaptivetopk_state"
+
+// checkpointState is the selection state that survives a collector restart.
+type checkpointState struct {
+	CurrentDynamicK   int                      `json:"current_dynamic_k"`
+	ProcessHysteresis map[string]time.Time     `json:"process_hysteresis,omitempty"`
+	PreviousValues    map[string]previousState `json:"previous_values,omitempty"`
+	SelectedSince     map[string]tenureState   `json:"selected_since,omitempty"`
+	HeavyHitters      *sketchState             `json:"heavy_hitters,omitempty"`
+	LoadForecast      *forecastState           `json:"load_forecast,omitempty"`
+}
+
+type previousState struct {
+	Value float64   `json:"value"`
+	Seen  time.Time `json:"seen"`
+}
+
+type forecastState struct {
+	Level        float64 `json:"level"`
+	Trend        float64 `json:"trend"`
+	Observations int     `json:"observations"`
+}
+
+type tenureState struct {
+	Since time.Time `json:"since"`
+	Seen  time.Time `json:"seen"`
+	PID   string    `json:"pid,omitempty"`
+}
+
+// startCheckpoints gets a client from the configured storage extension, restores the last
+// checkpoint and saves a new one every checkpoint_interval.
+func (p *adaptiveTopKProcessor) startCheckpoints(ctx context.Context, host component.Host) error {
+	ext, found := host.GetExtensions()[*p.config.Storage]
+	if !found {
+		return fmt.Errorf("storage extension %q not found", p.config.Storage)
+	}
+	storageExt, ok := ext.(storage.Extension)
+	if !ok {
+		return fmt.Errorf("extension %q is not a storage extension", p.config.Storage)
+	}
+	// The connector keeps its checkpoint apart from a processor with the same ID
+	kind := component.KindProcessor
+	if p.eventsConsumer != nil {
+		kind = component.KindConnector
+	}
+	client, err := storageExt.GetClient(ctx, kind, p.id, "")
+	if err != nil {
+		return fmt.Errorf("failed to get storage client: %w", err)
+	}
+	p.storageClient = client
+
+	if err := p.loadCheckpoint(ctx); err != nil {
+		// A missing or unreadable checkpoint only costs the warm start
+		if p.logger != nil {
+			p.logger.Warn("Failed to restore adaptivetopk state, starting fresh", zap.Error(err))
+		}
+	}
+
+	p.stopCheckpoint = make(chan struct{})
+	p.checkpointsDone = make(chan struct{})
+	go func() {
+		defer close(p.checkpointsDone)
+		ticker := time.NewTicker(p.config.CheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.saveCheckpoint(context.Background()); err != nil && p.logger != nil {
+					p.logger.Warn("Failed to checkpoint adaptivetopk state", zap.Error(err))
+				}
+			case <-p.stopCheckpoint:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// stopCheckpoints saves a final checkpoint and closes the storage client.
+func (p *adaptiveTopKProcessor) stopCheckpoints(ctx context.Context) error {
+	if p.storageClient == nil {
+		return nil
+	}
+	close(p.stopCheckpoint)
+	<-p.checkpointsDone
+
+	err := p.saveCheckpoint(ctx)
+	err = errors.Join(err, p.storageClient.Close(ctx))
+	p.storageClient = nil
+	return err
+}
+
+// saveCheckpoint writes the current state to storage.
+func (p *adaptiveTopKProcessor) saveCheckpoint(ctx context.Context) error {
+	p.mu.Lock()
+	state := p.checkpointState()
+	p.mu.Unlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return p.storageClient.Set(ctx, checkpointKey, data)
+}
+
+// loadCheckpoint restores the state saved by a previous run, if any.
+func (p *adaptiveTopKProcessor) loadCheckpoint(ctx context.Context) error {
+	data, err := p.storageClient.Get(ctx, checkpointKey)
+	if err != nil || data == nil {
+		return err
+	}
+	var state checkpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.restoreCheckpointState(state)
+	return nil
+}
+
+// checkpointState copies the selection state. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) checkpointState() checkpointState {
+	state := checkpointState{
+		CurrentDynamicK:   p.currentDynamicK,
+		ProcessHysteresis: make(map[string]time.Time, len(p.processHysteresis)),
+		PreviousValues:    make(map[string]previousState, len(p.previousValues)),
+		SelectedSince:     make(map[string]tenureState, len(p.selectedSince)),
+	}
+	for pid, expiry := range p.processHysteresis {
+		state.ProcessHysteresis[pid] = expiry
+	}
+	for pid, prev := range p.previousValues {
+		state.PreviousValues[pid] = previousState{Value: prev.value, Seen: prev.seen}
+	}
+	for pid, tenure := range p.selectedSince {
+		state.SelectedSince[pid] = tenureState{Since: tenure.since, Seen: tenure.seen, PID: tenure.pid}
+	}
+	if p.heavyHitters != nil {
+		state.HeavyHitters = p.heavyHitters.state()
+	}
+	if p.loadForecaster != nil {
+		holt := p.loadForecaster.State()
+		state.LoadForecast = &forecastState{Level: holt.Level, Trend: holt.Trend, Observations: holt.Observations}
+	}
+	return state
+}
+
+// restoreCheckpointState replaces the selection state with a checkpoint. State the current
+// configuration does not use is ignored, and K is clamped to the current min_k_value and
+// max_k_value. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) restoreCheckpointState(state checkpointState) {
+	if p.config.IsDynamicK() && state.CurrentDynamicK > 0 {
+		// Step from the restored K rather than from min_k_value
+		p.currentDynamicK = max(p.config.MinKValue, min(state.CurrentDynamicK, p.config.MaxKValue))
+		p.bandMapper = newBandMapper(p.config, p.currentDynamicK)
+		p.obsrep.recordCurrentKValue(context.Background(), int64(p.currentDynamicK))
+	}
+	for pid, expiry := range state.ProcessHysteresis {
+		p.processHysteresis[pid] = expiry
+	}
+	for pid, prev := range state.PreviousValues {
+		p.previousValues[pid] = previousValue{value: prev.Value, seen: prev.Seen}
+	}
+	for pid, tenure := range state.SelectedSince {
+		p.selectedSince[pid] = selectionTenure{since: tenure.Since, seen: tenure.Seen, pid: tenure.PID}
+	}
+	if p.heavyHitters != nil && state.HeavyHitters != nil {
+		p.heavyHitters.restore(state.HeavyHitters)
+	}
+	if p.loadForecaster != nil && state.LoadForecast != nil {
+		p.loadForecaster.Restore(banding.HoltState{
+			Level:        state.LoadForecast.Level,
+			Trend:        state.LoadForecast.Trend,
+			Observations: state.LoadForecast.Observations,
+		})
+	}
+}
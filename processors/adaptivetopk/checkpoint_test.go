@@ -0,0 +1,149 @@
+package adaptivetopk
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// memoryStorage is a storage extension keeping every client's data in memory, like
+// file storage does across restarts.
+type memoryStorage struct {
+	component.StartFunc
+	component.ShutdownFunc
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *memoryStorage) GetClient(_ context.Context, kind component.Kind, id component.ID, name string) (storage.Client, error) {
+	return &memoryClient{storage: s, prefix: kind.String() + "/" + id.String() + "/" + name + "/"}, nil
+}
+
+type memoryClient struct {
+	storage *memoryStorage
+	prefix  string
+}
+
+func (c *memoryClient) Get(_ context.Context, key string) ([]byte, error) {
+	c.storage.mu.Lock()
+	defer c.storage.mu.Unlock()
+	return c.storage.data[c.prefix+key], nil
+}
+
+func (c *memoryClient) Set(_ context.Context, key string, value []byte) error {
+	c.storage.mu.Lock()
+	defer c.storage.mu.Unlock()
+	c.storage.data[c.prefix+key] = value
+	return nil
+}
+
+func (c *memoryClient) Delete(_ context.Context, key string) error {
+	c.storage.mu.Lock()
+	defer c.storage.mu.Unlock()
+	delete(c.storage.data, c.prefix+key)
+	return nil
+}
+
+func (c *memoryClient) Batch(context.Context, ...storage.Operation) error { return nil }
+
+func (c *memoryClient) Close(context.Context) error { return nil }
+
+func TestAdaptiveTopK_CheckpointsStateAcrossRestarts(t *testing.T) {
+	storageID := component.NewID("file_storage")
+	store := &memoryStorage{data: make(map[string][]byte)}
+	host := extensionsHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{storageID: store},
+	}
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.5: 3}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 3
+	cfg.HysteresisDuration = time.Hour
+	cfg.MoversCount = 1
+	cfg.Storage = &storageID
+	cfg.CheckpointInterval = time.Hour
+	require.NoError(t, cfg.Validate())
+
+	batch := func(load float64, values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		hostLoad := sm.Metrics().AppendEmpty()
+		hostLoad.SetName("system.cpu.utilization")
+		hostLoad.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(load)
+		for pid, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", pid, v)
+		}
+		return md
+	}
+
+	first := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	require.NoError(t, first.Start(context.Background(), host))
+	require.NoError(t, first.ConsumeMetrics(context.Background(), batch(0.9, map[string]float64{"1": 0.9, "2": 0.8, "3": 0.7, "4": 0.1})))
+	require.NoError(t, first.Shutdown(context.Background()))
+	require.NotEmpty(t, store.data, "shutdown should checkpoint the state")
+
+	// After a restart, K and the hysteresis hold on 1-3 carry over even at low load
+	sink := new(consumertest.MetricsSink)
+	second := newTestProcessor(t, cfg, sink)
+	require.NoError(t, second.Start(context.Background(), host))
+	second.mu.Lock()
+	assert.Equal(t, 3, second.currentDynamicK)
+	assert.Len(t, second.processHysteresis, 3)
+	assert.Contains(t, second.previousValues, "4")
+	second.mu.Unlock()
+
+	require.NoError(t, second.ConsumeMetrics(context.Background(), batch(0.1, map[string]float64{"1": 0.9, "2": 0.8, "3": 0.7, "4": 0.1})))
+	assert.Equal(t, map[string]bool{"1": true, "2": true, "3": true}, extractPIDs(sink.AllMetrics()[0]))
+	require.NoError(t, second.Shutdown(context.Background()))
+}
+
+func TestAdaptiveTopK_RestoreCheckpointState(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.5: 2}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 2
+	cfg.ForecastLoad = true
+	require.NoError(t, cfg.Validate())
+
+	first := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	for _, load := range []float64{0.1, 0.2, 0.3} {
+		first.forecastLoad(context.Background(), load)
+	}
+	state := first.checkpointState()
+	require.NotNil(t, state.LoadForecast)
+
+	// The checkpoint was saved with a larger max_k_value than the current one
+	state.CurrentDynamicK = 5
+	second := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	second.restoreCheckpointState(state)
+	assert.Equal(t, 2, second.currentDynamicK)
+	assert.Equal(t, first.loadForecaster.State(), second.loadForecaster.State())
+	assert.InDelta(t, 0.5, second.forecastLoad(context.Background(), 0.4), 1e-9, "the forecast continues the trend")
+}
+
+func TestAdaptiveTopK_CheckpointStorageNotFound(t *testing.T) {
+	storageID := component.NewID("file_storage")
+	cfg := createDefaultConfig().(*Config)
+	cfg.Storage = &storageID
+	require.NoError(t, cfg.Validate())
+
+	proc := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	assert.EqualError(t, proc.Start(context.Background(), componenttest.NewNopHost()), `storage extension "file_storage" not found`)
+	assert.NoError(t, proc.Shutdown(context.Background()))
+
+	cfg.CheckpointInterval = 0
+	assert.EqualError(t, cfg.Validate(), "checkpoint_interval must be positive when storage is set")
+}
@@ -3,28 +3,152 @@ package adaptivetopk
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/confmap"
 )
 
+// Mode defines what the processor does with the processes it did not select.
+type Mode string
+
+const (
+	// FilterMode drops metrics from processes outside the selected set.
+	FilterMode Mode = "filter"
+	// AnnotateMode keeps every data point and tags it with the selection result.
+	AnnotateMode Mode = "annotate"
+)
+
+// Reducer defines how several data points of a ranking metric for one process are combined.
+type Reducer string
+
+const (
+	SumReducer  Reducer = "sum"
+	MaxReducer  Reducer = "max"
+	MeanReducer Reducer = "mean"
+)
+
+// SelectionMode defines how non-critical processes are ranked for selection.
+type SelectionMode string
+
+const (
+	// TopKSelection ranks processes by the key metric in the current batch.
+	TopKSelection SelectionMode = "topk"
+	// HeavyHittersSelection ranks processes by their decayed key metric total over a long
+	// window, tracked in a bounded Space-Saving sketch.
+	HeavyHittersSelection SelectionMode = "heavy_hitters"
+)
+
+// Ranking is an additional dimension processes are ranked by. Its top K non-critical
+// processes are kept on top of those of the key metric.
+type Ranking struct {
+	// MetricName is the metric processes are ranked by (e.g. "process.memory.rss").
+	MetricName string `mapstructure:"metric_name"`
+	// K is the number of top processes this ranking keeps.
+	K int `mapstructure:"k"`
+	// Reducer combines several data points per process. Empty uses key_metric_reducer.
+	Reducer Reducer `mapstructure:"reducer"`
+	// Attributes restricts the metric to data points matching all of these values.
+	Attributes map[string]string `mapstructure:"attributes"`
+}
+
+// KMode defines how many non-critical processes are selected.
+type KMode string
+
+const (
+	// CountKMode selects a fixed or dynamic number of processes.
+	CountKMode KMode = "count"
+	// PercentileKMode selects the processes whose ranking value is above a percentile of all of them.
+	PercentileKMode KMode = "percentile"
+	// CoverageKMode selects the smallest set of processes whose summed ranking value covers
+	// a share of the total.
+	CoverageKMode KMode = "coverage"
+	// BudgetKMode selects the processes covering the most ranking value within a budget of
+	// data points, choosing greedily by ranking value per data point.
+	BudgetKMode KMode = "budget"
+)
+
 // Config defines the configuration for the AdaptiveTopK processor.
 type Config struct {
+	// Mode is either "filter" (default) or "annotate".
+	Mode Mode `mapstructure:"mode"`
+
 	// KValue is the fixed number of top processes to keep (Sub-Phase 2a).
 	// If HostLoadMetricName is set, KValue is ignored.
 	KValue int `mapstructure:"k_value"`
 
+	// KMode is "count" (default, k_value or dynamic K), "percentile", "coverage" or "budget".
+	// The percentile and coverage modes derive K from the ranking values of each batch and
+	// bound it by MinKValue and MaxKValue; the budget mode fits processes into DataPointBudget.
+	KMode KMode `mapstructure:"k_mode"`
+	// KPercentile keeps the processes ranked above this percentile (e.g. 0.9) in percentile mode.
+	KPercentile float64 `mapstructure:"k_percentile"`
+	// KCoverage keeps the fewest processes whose ranking values sum to this share (e.g. 0.8)
+	// of the total in coverage mode.
+	KCoverage float64 `mapstructure:"k_coverage"`
+	// DataPointBudget is the number of in-scope data points a batch may keep in budget mode.
+	// Critical processes are kept regardless and use up the budget first.
+	DataPointBudget int `mapstructure:"data_point_budget"`
+
 	// KeyMetricName is the metric used to rank processes (e.g., "process.cpu.utilization").
 	KeyMetricName string `mapstructure:"key_metric_name"`
 	// SecondaryKeyMetricName is an optional metric for tie-breaking.
 	SecondaryKeyMetricName string `mapstructure:"secondary_key_metric_name"`
+	// KeyMetricReducer combines several data points per process (e.g. process.cpu.utilization
+	// split by state) into one ranking value: "sum" (default), "max" or "mean".
+	// It applies to the secondary metric as well.
+	KeyMetricReducer Reducer `mapstructure:"key_metric_reducer"`
+	// KeyMetricAttributes restricts the key metric to data points whose attributes
+	// match all of these values (e.g. direction: write for process.disk.io).
+	// It does not apply to the secondary metric, whose data points have other attributes.
+	KeyMetricAttributes map[string]string `mapstructure:"key_metric_attributes"`
+	// Rankings are additional rankings, each keeping its own top K. The selected set is the
+	// union of all rankings, so a memory-heavy but idle process can be kept next to the
+	// busiest ones by CPU.
+	Rankings []Ranking `mapstructure:"rankings"`
+
+	// EntityAttributes identify what is ranked: process.pid (default) ranks processes, other
+	// attributes such as container.id or k8s.pod.uid rank containers or pods. With several
+	// attributes an entity is identified by all of their values. Empty ranks processes.
+	EntityAttributes []string `mapstructure:"entity_attributes"`
+
+	// IncludeMetrics are regular expressions, matched against the whole metric name, of the
+	// metrics that take part in selection. Empty includes every metric.
+	IncludeMetrics []string `mapstructure:"include_metrics"`
+	// ExcludeMetrics are regular expressions of metrics taken out of selection even when
+	// they match IncludeMetrics. Metrics outside selection, and the host load metric,
+	// pass through untouched.
+	ExcludeMetrics []string `mapstructure:"exclude_metrics"`
 
 	// PriorityAttributeName is the attribute identifying critical processes.
 	PriorityAttributeName string `mapstructure:"priority_attribute_name"`
 	// CriticalAttributeValue is the value indicating a critical process.
 	CriticalAttributeValue string `mapstructure:"critical_attribute_value"`
 
+	// SelectionMode is either "topk" (default) or "heavy_hitters".
+	SelectionMode SelectionMode `mapstructure:"selection_mode"`
+	// HeavyHittersCapacity is the number of processes the heavy-hitters sketch monitors.
+	HeavyHittersCapacity int `mapstructure:"heavy_hitters_capacity"`
+	// HeavyHittersHalfLife is the time after which a key metric contribution counts half.
+	HeavyHittersHalfLife time.Duration `mapstructure:"heavy_hitters_half_life"`
+
+	// MoversCount additionally keeps the M processes whose key metric changed the most,
+	// up or down, since the previous batch. Zero disables it.
+	MoversCount int `mapstructure:"movers_count"`
+
+	// GroupByAttributes splits processes into groups (e.g. "process.executable.name").
+	// When set, K applies to each group separately instead of to all processes.
+	GroupByAttributes []string `mapstructure:"group_by"`
+	// MaxTotalK optionally caps the number of processes selected across all groups.
+	// Zero means no cap. Only used with group_by.
+	MaxTotalK int `mapstructure:"max_total_k"`
+
+	// PerIntervalDecisions keys the selection by collection timestamp. The first batch of an
+	// interval settles the selection and later batches with the same timestamp reuse it,
+	// so a scrape split across several ConsumeMetrics calls still keeps at most K processes.
+	PerIntervalDecisions bool `mapstructure:"per_interval_decisions"`
+
 	// --- Sub-Phase 2b: Dynamic K & Hysteresis ---
 	// HostLoadMetricName is the metric for overall host load (e.g., "system.cpu.utilization").
 	// If set, KValue is ignored, and dynamic K is used.
@@ -38,6 +162,36 @@ type Config struct {
 	MinKValue int `mapstructure:"min_k_value"`
 	// MaxKValue is the maximum bound for dynamic K.
 	MaxKValue int `mapstructure:"max_k_value"`
+	// LoadBandHysteresis is how far below a band's threshold the host load must fall
+	// before K moves down a band. Zero moves down as soon as the load crosses the threshold.
+	LoadBandHysteresis float64 `mapstructure:"load_band_hysteresis"`
+	// MinBandDwell is the minimum time K stays in a load band before it may change band.
+	MinBandDwell time.Duration `mapstructure:"min_band_dwell"`
+	// MaxKStep limits how much K may change per batch. Zero jumps straight to the band's K.
+	MaxKStep int `mapstructure:"max_k_step"`
+	// ForecastLoad sets K from the host load forecast for the next interval, using Holt's
+	// linear trend method, instead of from the current load. K then grows ahead of a rising load.
+	ForecastLoad bool `mapstructure:"forecast_load"`
+	// ForecastAlpha smooths the forecast level, in (0, 1]. Higher follows the load faster.
+	ForecastAlpha float64 `mapstructure:"forecast_alpha"`
+	// ForecastBeta smooths the forecast trend, in (0, 1]. Higher follows trend changes faster.
+	ForecastBeta float64 `mapstructure:"forecast_beta"`
+
+	// --- State persistence ---
+	// Storage is the ID of a storage extension used to checkpoint the hysteresis, dynamic K
+	// and per-process smoothing state, so that a restart does not reset selection. Nil disables it.
+	Storage *component.ID `mapstructure:"storage"`
+	// CheckpointInterval is how often the state is checkpointed, in addition to on shutdown.
+	CheckpointInterval time.Duration `mapstructure:"checkpoint_interval"`
+
+	// --- Annotate mode ---
+	// SelectedAttributeName is set to true or false on every data point of a ranked process.
+	SelectedAttributeName string `mapstructure:"selected_attribute_name"`
+	// RankAttributeName holds the 1-based rank of a non-critical process by the key metric.
+	RankAttributeName string `mapstructure:"rank_attribute_name"`
+	// ReasonAttributeName optionally records why a process was selected
+	// ("critical", "rank", "rank:<metric>", "mover" or "hysteresis"). Leave empty to omit it.
+	ReasonAttributeName string `mapstructure:"reason_attribute_name"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -55,9 +209,116 @@ func (cfg *Config) Validate() error {
 		return errors.New("critical_attribute_value must be specified")
 	}
 
+	if err := validateReducer("key_metric_reducer", cfg.KeyMetricReducer); err != nil {
+		return err
+	}
+	switch cfg.SelectionMode {
+	case "", TopKSelection:
+	case HeavyHittersSelection:
+		if cfg.HeavyHittersCapacity <= 0 {
+			return errors.New("heavy_hitters_capacity must be positive when selection_mode is heavy_hitters")
+		}
+		if cfg.HeavyHittersHalfLife <= 0 {
+			return errors.New("heavy_hitters_half_life must be positive when selection_mode is heavy_hitters")
+		}
+	default:
+		return fmt.Errorf("invalid selection_mode %q, supported: %s, %s", cfg.SelectionMode, TopKSelection, HeavyHittersSelection)
+	}
+	for _, attr := range cfg.EntityAttributes {
+		if attr == "" {
+			return errors.New("entity_attributes cannot contain empty strings")
+		}
+	}
+	scope, err := newSelectionScope(cfg)
+	if err != nil {
+		return err
+	}
+	if !scope.contains(cfg.KeyMetricName) {
+		return fmt.Errorf("key_metric_name %q must match include_metrics and not exclude_metrics", cfg.KeyMetricName)
+	}
+	for i, r := range cfg.Rankings {
+		if r.MetricName == "" {
+			return fmt.Errorf("rankings[%d]: metric_name must be specified", i)
+		}
+		if r.K <= 0 {
+			return fmt.Errorf("rankings[%d]: k must be positive", i)
+		}
+		if err := validateReducer(fmt.Sprintf("rankings[%d].reducer", i), r.Reducer); err != nil {
+			return err
+		}
+		if !scope.contains(r.MetricName) {
+			return fmt.Errorf("rankings[%d]: metric_name %q must match include_metrics and not exclude_metrics", i, r.MetricName)
+		}
+	}
+	for _, attr := range cfg.GroupByAttributes {
+		if attr == "" {
+			return errors.New("group_by cannot contain empty strings")
+		}
+	}
+	if cfg.MoversCount < 0 {
+		return errors.New("movers_count cannot be negative")
+	}
+	if cfg.MaxTotalK < 0 {
+		return errors.New("max_total_k cannot be negative")
+	}
+	if cfg.Storage != nil && cfg.CheckpointInterval <= 0 {
+		return errors.New("checkpoint_interval must be positive when storage is set")
+	}
+
+	switch cfg.Mode {
+	case "", FilterMode:
+	case AnnotateMode:
+		if cfg.SelectedAttributeName == "" {
+			return errors.New("selected_attribute_name must be specified when mode is annotate")
+		}
+		if cfg.RankAttributeName == "" {
+			return errors.New("rank_attribute_name must be specified when mode is annotate")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q, supported: %s, %s", cfg.Mode, FilterMode, AnnotateMode)
+	}
+
 	isDynamicK := cfg.HostLoadMetricName != ""
 	isFixedK := cfg.KValue > 0
 
+	if cfg.ForecastLoad && !isDynamicK {
+		return errors.New("forecast_load requires host_load_metric_name")
+	}
+
+	switch cfg.KMode {
+	case "", CountKMode:
+	case BudgetKMode:
+		if isDynamicK {
+			return fmt.Errorf("host_load_metric_name cannot be used when k_mode is %s", cfg.KMode)
+		}
+		if cfg.DataPointBudget <= 0 {
+			return errors.New("data_point_budget must be positive when k_mode is budget")
+		}
+		if len(cfg.GroupByAttributes) > 0 {
+			return errors.New("group_by cannot be used when k_mode is budget")
+		}
+		return nil
+	case PercentileKMode, CoverageKMode:
+		if isDynamicK {
+			return fmt.Errorf("host_load_metric_name cannot be used when k_mode is %s", cfg.KMode)
+		}
+		if cfg.KMode == PercentileKMode && (cfg.KPercentile <= 0 || cfg.KPercentile >= 1) {
+			return errors.New("k_percentile must be between 0 and 1 when k_mode is percentile")
+		}
+		if cfg.KMode == CoverageKMode && (cfg.KCoverage <= 0 || cfg.KCoverage > 1) {
+			return errors.New("k_coverage must be greater than 0 and at most 1 when k_mode is coverage")
+		}
+		if cfg.MinKValue < 0 {
+			return fmt.Errorf("min_k_value cannot be negative when k_mode is %s", cfg.KMode)
+		}
+		if cfg.MaxKValue < cfg.MinKValue {
+			return fmt.Errorf("max_k_value must be greater than or equal to min_k_value when k_mode is %s", cfg.KMode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid k_mode %q, supported: %s, %s, %s, %s", cfg.KMode, CountKMode, PercentileKMode, CoverageKMode, BudgetKMode)
+	}
+
 	if isDynamicK {
 		if len(cfg.LoadBandsToKMap) == 0 {
 			return errors.New("load_bands_to_k_map must be specified when host_load_metric_name is set")
@@ -68,6 +329,21 @@ func (cfg *Config) Validate() error {
 		if cfg.MaxKValue < cfg.MinKValue {
 			return errors.New("max_k_value must be greater than or equal to min_k_value when host_load_metric_name is set")
 		}
+		if cfg.LoadBandHysteresis < 0 {
+			return errors.New("load_band_hysteresis cannot be negative")
+		}
+		if cfg.MinBandDwell < 0 {
+			return errors.New("min_band_dwell cannot be negative")
+		}
+		if cfg.MaxKStep < 0 {
+			return errors.New("max_k_step cannot be negative")
+		}
+		if cfg.ForecastLoad && (cfg.ForecastAlpha <= 0 || cfg.ForecastAlpha > 1) {
+			return errors.New("forecast_alpha must be greater than 0 and at most 1")
+		}
+		if cfg.ForecastLoad && (cfg.ForecastBeta <= 0 || cfg.ForecastBeta > 1) {
+			return errors.New("forecast_beta must be greater than 0 and at most 1")
+		}
 		// Further validation for LoadBandsToKMap keys and values can be added.
 		for threshold, k := range cfg.LoadBandsToKMap {
 			if threshold < 0 || threshold > 1.0 { // Assuming load is a utilization metric
@@ -93,26 +369,137 @@ func (cfg *Config) Unmarshal(componentParser *confmap.Conf) error {
 	}
 
 	// Set defaults (Fixed K defaults)
+	cfg.Mode = FilterMode
 	cfg.KValue = 10 // Default fixed K
+	cfg.KMode = CountKMode
+	cfg.KPercentile = 0.9
+	cfg.KCoverage = 0.8
+	cfg.DataPointBudget = 0
 	cfg.KeyMetricName = "process.cpu.utilization"
+	cfg.KeyMetricReducer = SumReducer
+	cfg.KeyMetricAttributes = make(map[string]string)
+	cfg.Rankings = []Ranking{}
+	cfg.EntityAttributes = []string{processPIDKey}
+	cfg.IncludeMetrics = []string{`process\..*`}
+	cfg.ExcludeMetrics = []string{}
 	cfg.PriorityAttributeName = "nr.priority"
 	cfg.CriticalAttributeValue = "critical"
+	cfg.SelectionMode = TopKSelection
+	cfg.HeavyHittersCapacity = 1000
+	cfg.HeavyHittersHalfLife = 15 * time.Minute
+	cfg.MoversCount = 0
+	cfg.GroupByAttributes = []string{}
+	cfg.MaxTotalK = 0
+	cfg.PerIntervalDecisions = false
 
 	// Dynamic K defaults (if user enables dynamic K by setting HostLoadMetricName)
 	cfg.HostLoadMetricName = ""
 	cfg.LoadBandsToKMap = make(map[float64]int)
 	cfg.HysteresisDuration = 1 * time.Minute
+	cfg.LoadBandHysteresis = 0
+	cfg.MinBandDwell = 0
+	cfg.MaxKStep = 0
+	cfg.ForecastLoad = false
+	cfg.ForecastAlpha = 0.5
+	cfg.ForecastBeta = 0.3
 	cfg.MinKValue = 5
 	cfg.MaxKValue = 20
 
+	// State persistence defaults
+	cfg.Storage = nil
+	cfg.CheckpointInterval = 30 * time.Second
+
+	// Annotate mode defaults
+	cfg.SelectedAttributeName = "nr.topk.selected"
+	cfg.RankAttributeName = "nr.topk.rank"
+	cfg.ReasonAttributeName = "nr.topk.reason"
+
 	return componentParser.Unmarshal(cfg)
 }
 
+// validateReducer checks the reducer of the named setting. Empty selects the default.
+func validateReducer(setting string, reducer Reducer) error {
+	switch reducer {
+	case "", SumReducer, MaxReducer, MeanReducer:
+		return nil
+	default:
+		return fmt.Errorf("invalid %s %q, supported: %s, %s, %s", setting, reducer, SumReducer, MaxReducer, MeanReducer)
+	}
+}
+
 // IsDynamicK returns true if the processor is configured for dynamic K.
 func (cfg *Config) IsDynamicK() bool {
 	return cfg.HostLoadMetricName != ""
 }
 
+// selectionScope holds the compiled include_metrics and exclude_metrics patterns.
+type selectionScope struct {
+	hostLoadMetricName string
+	include            []*regexp.Regexp
+	exclude            []*regexp.Regexp
+}
+
+// newSelectionScope compiles the metric patterns of cfg.
+func newSelectionScope(cfg *Config) (*selectionScope, error) {
+	include, err := compileMetricPatterns("include_metrics", cfg.IncludeMetrics)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileMetricPatterns("exclude_metrics", cfg.ExcludeMetrics)
+	if err != nil {
+		return nil, err
+	}
+	return &selectionScope{hostLoadMetricName: cfg.HostLoadMetricName, include: include, exclude: exclude}, nil
+}
+
+// contains reports whether a metric takes part in selection. Data points of other metrics
+// pass through untouched.
+func (s *selectionScope) contains(metricName string) bool {
+	if s.hostLoadMetricName != "" && metricName == s.hostLoadMetricName {
+		return false
+	}
+	if len(s.include) > 0 && !matchesAny(s.include, metricName) {
+		return false
+	}
+	return !matchesAny(s.exclude, metricName)
+}
+
+// compileMetricPatterns compiles the metric name patterns of the named setting, anchored
+// so that they match the whole metric name.
+func compileMetricPatterns(setting string, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("%s cannot contain empty patterns", setting)
+		}
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %w", setting, pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdaptiveK returns true if K is derived from each batch.
+func (cfg *Config) IsAdaptiveK() bool {
+	return cfg.KMode == PercentileKMode || cfg.KMode == CoverageKMode || cfg.KMode == BudgetKMode
+}
+
+// IsAnnotateMode returns true if the processor tags data points instead of dropping them.
+func (cfg *Config) IsAnnotateMode() bool {
+	return cfg.Mode == AnnotateMode
+}
+
 // ProcessorType returns the processor type for metrics usage
 func (cfg *Config) ProcessorType() string {
 	return "adaptivetopk"
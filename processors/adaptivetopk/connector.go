@@ -0,0 +1,49 @@
+package adaptivetopk
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/processor"
+)
+
+// NewConnectorFactory creates a factory for the AdaptiveTopK connector. It makes the same
+// selection as the processor on the metrics of a pipeline and emits a log record whenever a
+// process enters or leaves the selected set, or dynamic K changes band.
+func NewConnectorFactory() connector.Factory {
+	return connector.NewFactory(
+		typeStr,
+		createDefaultConfig,
+		connector.WithMetricsToLogs(createMetricsToLogsConnector, stability),
+	)
+}
+
+func createMetricsToLogsConnector(
+	ctx context.Context,
+	set connector.CreateSettings,
+	cfg component.Config,
+	nextConsumer consumer.Logs,
+) (connector.Metrics, error) {
+	connectorCfg := cfg.(*Config)
+	if err := connectorCfg.Validate(); err != nil {
+		return nil, err
+	}
+	// The selected metrics go nowhere, only the events leave the connector
+	discard, err := consumer.NewMetrics(func(context.Context, pmetric.Metrics) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	p, err := newAdaptiveTopKProcessor(processor.CreateSettings{
+		ID:                set.ID,
+		TelemetrySettings: set.TelemetrySettings,
+		BuildInfo:         set.BuildInfo,
+	}, discard, connectorCfg)
+	if err != nil {
+		return nil, err
+	}
+	p.eventsConsumer = nextConsumer
+	return p, nil
+}
@@ -0,0 +1,148 @@
+package adaptivetopk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/connector"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// eventSummary is what the tests check of an event log record.
+type eventSummary struct {
+	name   string
+	pid    string
+	rank   int64
+	reason string
+	k      int64
+}
+
+func eventSummaries(ld plog.Logs) []eventSummary {
+	var out []eventSummary
+	records := ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	for i := 0; i < records.Len(); i++ {
+		attrs := records.At(i).Attributes()
+		var e eventSummary
+		if v, ok := attrs.Get("event.name"); ok {
+			e.name = v.Str()
+		}
+		if v, ok := attrs.Get(processPIDKey); ok {
+			e.pid = v.Str()
+		}
+		if v, ok := attrs.Get("nr.topk.rank"); ok {
+			e.rank = v.Int()
+		}
+		if v, ok := attrs.Get("nr.topk.reason"); ok {
+			e.reason = v.Str()
+		}
+		if v, ok := attrs.Get("nr.topk.k"); ok {
+			e.k = v.Int()
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func TestAdaptiveTopKConnector_EmitsSelectionEvents(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.5: 2}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 2
+	cfg.HysteresisDuration = 0
+
+	sink := new(consumertest.LogsSink)
+	conn, err := NewConnectorFactory().CreateMetricsToLogs(context.Background(), connector.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}, cfg, sink)
+	require.NoError(t, err)
+	require.NoError(t, conn.Start(context.Background(), componenttest.NewNopHost()))
+
+	batch := func(load float64, values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		hostLoad := sm.Metrics().AppendEmpty()
+		hostLoad.SetName("system.cpu.utilization")
+		hostLoad.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(load)
+		for pid, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", pid, v)
+		}
+		return md
+	}
+
+	// High load raises K to 2, so the top two processes enter
+	require.NoError(t, conn.ConsumeMetrics(context.Background(), batch(0.9, map[string]float64{"1": 0.9, "2": 0.8, "3": 0.1})))
+	require.Len(t, sink.AllLogs(), 1)
+	assert.ElementsMatch(t, []eventSummary{
+		{name: eventKChanged, k: 2},
+		{name: eventProcessEntered, pid: "1", rank: 1, reason: reasonRank},
+		{name: eventProcessEntered, pid: "2", rank: 2, reason: reasonRank},
+	}, eventSummaries(sink.AllLogs()[0]))
+
+	// An unchanged selection emits nothing
+	require.NoError(t, conn.ConsumeMetrics(context.Background(), batch(0.9, map[string]float64{"1": 0.9, "2": 0.8, "3": 0.1})))
+	assert.Len(t, sink.AllLogs(), 1)
+
+	// Low load drops K back to 1, and PID 3 overtakes PID 1
+	require.NoError(t, conn.ConsumeMetrics(context.Background(), batch(0.1, map[string]float64{"1": 0.5, "2": 0.4, "3": 0.7})))
+	require.Len(t, sink.AllLogs(), 2)
+	assert.ElementsMatch(t, []eventSummary{
+		{name: eventKChanged, k: 1},
+		{name: eventProcessEntered, pid: "3", rank: 1, reason: reasonRank},
+		{name: eventProcessLeft, pid: "1", rank: 2, reason: leftNotSelected},
+		{name: eventProcessLeft, pid: "2", rank: 3, reason: leftNotSelected},
+	}, eventSummaries(sink.AllLogs()[1]))
+
+	record := sink.AllLogs()[1].ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	assert.Equal(t, plog.SeverityNumberInfo, record.SeverityNumber())
+	assert.NotZero(t, record.Timestamp())
+	require.NoError(t, conn.Shutdown(context.Background()))
+}
+
+func TestAdaptiveTopKConnector_CheckpointsApartFromProcessor(t *testing.T) {
+	storageID := component.NewID("file_storage")
+	store := &memoryStorage{data: make(map[string][]byte)}
+	host := extensionsHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{storageID: store},
+	}
+	cfg := createDefaultConfig().(*Config)
+	cfg.Storage = &storageID
+	require.NoError(t, cfg.Validate())
+
+	// A processor and a connector with the same ID
+	proc := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	conn, err := NewConnectorFactory().CreateMetricsToLogs(context.Background(), connector.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}, cfg, new(consumertest.LogsSink))
+	require.NoError(t, err)
+	for _, c := range []component.Component{proc, conn} {
+		require.NoError(t, c.Start(context.Background(), host))
+		require.NoError(t, c.Shutdown(context.Background()))
+	}
+
+	assert.Len(t, store.data, 2)
+	assert.Contains(t, store.data, "Processor/adaptivetopk//"+checkpointKey)
+	assert.Contains(t, store.data, "Connector/adaptivetopk//"+checkpointKey)
+}
+
+func TestAdaptiveTopKProcessor_QueuesNoEvents(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 1
+	proc := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+
+	md := pmetric.NewMetrics()
+	appendProcessGauge(md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty(), "process.cpu.utilization", "1", 0.5)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	assert.Empty(t, proc.pendingEvents)
+}
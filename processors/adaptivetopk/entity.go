@@ -0,0 +1,64 @@
+package adaptivetopk
+
+import (
+	"strings"
+
+	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
+)
+
+// entityIDKey is the event attribute holding the ID of an entity other than a process.
+const entityIDKey = "nr.topk.entity"
+
+var defaultEntityAttributes = []string{processPIDKey}
+
+// entityAttributes returns the attributes identifying an entity, process.pid by default.
+func (cfg *Config) entityAttributes() []string {
+	if len(cfg.EntityAttributes) == 0 {
+		return defaultEntityAttributes
+	}
+	return cfg.EntityAttributes
+}
+
+// isProcessEntity reports whether entities are processes identified by process.pid, the default.
+func (cfg *Config) isProcessEntity() bool {
+	names := cfg.entityAttributes()
+	return len(names) == 1 && names[0] == processPIDKey
+}
+
+// entityID returns the ID of the entity a data point belongs to within a batch: the value of
+// the entity attribute, or the values of several joined by "/". ok is false when any of them
+// is missing.
+func (p *adaptiveTopKProcessor) entityID(attrs metricsutil.Attributes) (id string, ok bool) {
+	names := p.config.entityAttributes()
+	if len(names) == 1 {
+		val, found := attrs.Get(names[0])
+		if !found {
+			return "", false
+		}
+		return val.AsString(), true
+	}
+	values := make([]string, len(names))
+	for i, name := range names {
+		val, found := attrs.Get(name)
+		if !found {
+			return "", false
+		}
+		values[i] = val.AsString()
+	}
+	return strings.Join(values, "/"), true
+}
+
+// entityKey returns the key that selection state of an entity is kept under across batches,
+// along with its ID. Processes are keyed by their identity among the batch's identities, so
+// that a reused PID is a new process; other entities, such as containers or pods, by their ID.
+func (p *adaptiveTopKProcessor) entityKey(identities metricsutil.ProcessIdentities, attrs metricsutil.Attributes) (key, id string, ok bool) {
+	id, ok = p.entityID(attrs)
+	if !ok {
+		return "", "", false
+	}
+	if !p.config.isProcessEntity() {
+		return id, id, true
+	}
+	key, _ = identities.Get(attrs)
+	return key, id, true
+}
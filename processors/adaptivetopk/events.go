@@ -0,0 +1,108 @@
+package adaptivetopk
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// Names of the selection events, in the event.name attribute of their log records.
+const (
+	eventProcessEntered = "adaptivetopk.process.entered"
+	eventProcessLeft    = "adaptivetopk.process.left"
+	eventKChanged       = "adaptivetopk.k.changed"
+)
+
+// Reasons a process left the selected set.
+const (
+	leftNotSelected      = "not_selected"
+	leftStoppedReporting = "stopped_reporting"
+)
+
+// selectionEvent is a process entering or leaving the selected set, or dynamic K changing,
+// emitted as a log record by the connector.
+type selectionEvent struct {
+	name   string
+	time   time.Time
+	pid    string
+	rank   int     // Rank among non-critical processes, 0 if not ranked
+	value  float64 // Key metric value the process was ranked by
+	reason string  // Why the process entered or left
+
+	// K changes only
+	previousK, k int
+	band         int
+	hostLoad     float64
+}
+
+// addEvent queues an event for the connector. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) addEvent(e selectionEvent) {
+	if p.eventsConsumer != nil {
+		p.pendingEvents = append(p.pendingEvents, e)
+	}
+}
+
+// takeEvents returns the queued events and clears the queue. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) takeEvents() []selectionEvent {
+	events := p.pendingEvents
+	p.pendingEvents = nil
+	return events
+}
+
+// emitEvents sends events to the connector's logs pipeline, one log record each.
+func (p *adaptiveTopKProcessor) emitEvents(ctx context.Context, events []selectionEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ld := plog.NewLogs()
+	sl := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty()
+	sl.Scope().SetName(typeStr)
+	records := sl.LogRecords()
+	records.EnsureCapacity(len(events))
+	for _, e := range events {
+		p.eventRecord(e, records.AppendEmpty())
+	}
+	return p.eventsConsumer.ConsumeLogs(ctx, ld)
+}
+
+// eventRecord fills lr with e.
+func (p *adaptiveTopKProcessor) eventRecord(e selectionEvent, lr plog.LogRecord) {
+	ts := pcommon.NewTimestampFromTime(e.time)
+	lr.SetTimestamp(ts)
+	lr.SetObservedTimestamp(ts)
+	lr.SetSeverityNumber(plog.SeverityNumberInfo)
+	lr.SetSeverityText("INFO")
+
+	attrs := lr.Attributes()
+	attrs.PutStr("event.name", e.name)
+	if e.name == eventKChanged {
+		lr.Body().SetStr(fmt.Sprintf("Dynamic K changed from %d to %d (band %d, host load %g)", e.previousK, e.k, e.band, e.hostLoad))
+		attrs.PutInt("nr.topk.k", int64(e.k))
+		attrs.PutInt("nr.topk.previous_k", int64(e.previousK))
+		attrs.PutInt("nr.topk.band", int64(e.band))
+		attrs.PutDouble("nr.topk.host_load", e.hostLoad)
+		return
+	}
+
+	if e.name == eventProcessEntered {
+		lr.Body().SetStr(fmt.Sprintf("Process %s entered the selected set (%s)", e.pid, e.reason))
+	} else {
+		lr.Body().SetStr(fmt.Sprintf("Process %s left the selected set (%s)", e.pid, e.reason))
+	}
+	if p.config.isProcessEntity() {
+		attrs.PutStr(processPIDKey, e.pid)
+	} else {
+		attrs.PutStr(entityIDKey, e.pid)
+	}
+	attrs.PutStr("nr.topk.reason", e.reason)
+	if e.rank > 0 {
+		attrs.PutInt("nr.topk.rank", int64(e.rank))
+	}
+	if e.reason != leftStoppedReporting {
+		attrs.PutStr("nr.topk.metric_name", p.config.KeyMetricName)
+		attrs.PutDouble("nr.topk.metric_value", e.value)
+	}
+}
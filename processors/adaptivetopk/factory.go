@@ -25,15 +25,41 @@ func NewFactory() processor.Factory {
 
 func createDefaultConfig() component.Config {
 	return &Config{
+		Mode:                   FilterMode,
 		KValue:                 10,
+		KMode:                  CountKMode,
+		KPercentile:            0.9,
+		KCoverage:              0.8,
+		DataPointBudget:        0,
 		KeyMetricName:          "process.cpu.utilization",
+		KeyMetricReducer:       SumReducer,
+		KeyMetricAttributes:    make(map[string]string),
+		Rankings:               []Ranking{},
+		EntityAttributes:       []string{processPIDKey},
+		IncludeMetrics:         []string{`process\..*`},
+		ExcludeMetrics:         []string{},
 		PriorityAttributeName:  "nr.priority",
 		CriticalAttributeValue: "critical",
+		SelectionMode:          TopKSelection,
+		HeavyHittersCapacity:   1000,
+		HeavyHittersHalfLife:   15 * time.Minute,
+		MoversCount:            0,
+		GroupByAttributes:      []string{},
 		HostLoadMetricName:     "", // Dynamic K disabled by default
 		LoadBandsToKMap:        make(map[float64]int),
 		HysteresisDuration:     1 * time.Minute,
 		MinKValue:              5,
 		MaxKValue:              20,
+		LoadBandHysteresis:     0,
+		MinBandDwell:           0,
+		MaxKStep:               0,
+		ForecastLoad:           false,
+		ForecastAlpha:          0.5,
+		ForecastBeta:           0.3,
+		CheckpointInterval:     30 * time.Second,
+		SelectedAttributeName:  "nr.topk.selected",
+		RankAttributeName:      "nr.topk.rank",
+		ReasonAttributeName:    "nr.topk.reason",
 	}
 }
 
@@ -0,0 +1,162 @@
+package adaptivetopk
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"time"
+)
+
+// hhCounter is one monitored key of the Space-Saving sketch.
+type hhCounter struct {
+	key   string
+	count float64 // Decayed weight, an overestimate by at most err
+	err   float64 // Weight inherited from the evicted counter
+	index int     // For heap interface
+}
+
+// hhHeap is a min-heap of counters by count, so the smallest counter is evicted first.
+type hhHeap []*hhCounter
+
+func (h hhHeap) Len() int           { return len(h) }
+func (h hhHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hhHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hhHeap) Push(x any) {
+	c := x.(*hhCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+func (h *hhHeap) Pop() any {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	old[n-1] = nil // avoid memory leak
+	c.index = -1   // for safety
+	*h = old[:n-1]
+	return c
+}
+
+// spaceSaving is a Space-Saving heavy-hitters sketch with exponential time decay.
+// It monitors at most capacity keys, so memory stays bounded no matter how many
+// short-lived processes pass through. It is not safe for concurrent use.
+type spaceSaving struct {
+	capacity  int
+	halfLife  time.Duration
+	counters  map[string]*hhCounter
+	minHeap   hhHeap
+	lastDecay time.Time
+}
+
+func newSpaceSaving(capacity int, halfLife time.Duration) *spaceSaving {
+	return &spaceSaving{
+		capacity: capacity,
+		halfLife: halfLife,
+		counters: make(map[string]*hhCounter, capacity),
+		minHeap:  make(hhHeap, 0, capacity),
+	}
+}
+
+// decay scales every counter by 0.5^(elapsed/halfLife). Scaling all counters by the
+// same factor keeps the heap order, so no re-heapify is needed.
+func (s *spaceSaving) decay(now time.Time) {
+	if s.lastDecay.IsZero() || s.halfLife <= 0 {
+		s.lastDecay = now
+		return
+	}
+	elapsed := now.Sub(s.lastDecay)
+	if elapsed <= 0 {
+		return
+	}
+	factor := math.Pow(0.5, float64(elapsed)/float64(s.halfLife))
+	for _, c := range s.minHeap {
+		c.count *= factor
+		c.err *= factor
+	}
+	s.lastDecay = now
+}
+
+// add records weight for key, evicting the smallest counter when the sketch is full.
+func (s *spaceSaving) add(key string, weight float64) {
+	if weight < 0 {
+		weight = 0
+	}
+	if c, ok := s.counters[key]; ok {
+		c.count += weight
+		heap.Fix(&s.minHeap, c.index)
+		return
+	}
+	if len(s.minHeap) < s.capacity {
+		c := &hhCounter{key: key, count: weight}
+		heap.Push(&s.minHeap, c)
+		s.counters[key] = c
+		return
+	}
+
+	// Replace the minimum: the newcomer inherits its count as the error bound
+	c := s.minHeap[0]
+	delete(s.counters, c.key)
+	c.key = key
+	c.err = c.count
+	c.count += weight
+	s.counters[key] = c
+	heap.Fix(&s.minHeap, 0)
+}
+
+// estimate returns the guaranteed decayed weight of key, or 0 if the key is not monitored.
+// The weight inherited on admission is left out, so a newly admitted key does not outrank
+// the keys that earned their counts.
+func (s *spaceSaving) estimate(key string) float64 {
+	if c, ok := s.counters[key]; ok {
+		return c.count - c.err
+	}
+	return 0
+}
+
+// len returns the number of monitored keys.
+func (s *spaceSaving) len() int {
+	return len(s.minHeap)
+}
+
+// sketchState is the serializable state of a spaceSaving sketch.
+type sketchState struct {
+	LastDecay time.Time      `json:"last_decay"`
+	Counters  []counterState `json:"counters"`
+}
+
+type counterState struct {
+	Key   string  `json:"key"`
+	Count float64 `json:"count"`
+	Err   float64 `json:"err"`
+}
+
+// state returns the sketch's counters for a checkpoint.
+func (s *spaceSaving) state() *sketchState {
+	st := &sketchState{LastDecay: s.lastDecay, Counters: make([]counterState, 0, len(s.minHeap))}
+	for _, c := range s.minHeap {
+		st.Counters = append(st.Counters, counterState{Key: c.key, Count: c.count, Err: c.err})
+	}
+	return st
+}
+
+// restore replaces the sketch's counters with those of a checkpoint, keeping the
+// largest ones if the capacity has shrunk since.
+func (s *spaceSaving) restore(st *sketchState) {
+	counters := append([]counterState(nil), st.Counters...)
+	sort.Slice(counters, func(i, j int) bool { return counters[i].Count > counters[j].Count })
+	if len(counters) > s.capacity {
+		counters = counters[:s.capacity]
+	}
+
+	s.counters = make(map[string]*hhCounter, s.capacity)
+	s.minHeap = make(hhHeap, 0, s.capacity)
+	for _, cs := range counters {
+		c := &hhCounter{key: cs.Key, count: cs.Count, err: cs.Err}
+		heap.Push(&s.minHeap, c)
+		s.counters[cs.Key] = c
+	}
+	s.lastDecay = st.LastDecay
+}
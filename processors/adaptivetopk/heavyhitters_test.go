@@ -0,0 +1,56 @@
+package adaptivetopk
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpaceSaving_BoundedMemory(t *testing.T) {
+	s := newSpaceSaving(10, 10*time.Minute)
+
+	// Two steady heavy hitters among thousands of short-lived processes
+	for i := 0; i < 5000; i++ {
+		s.add("heavy-1", 5)
+		s.add("heavy-2", 3)
+		s.add("short-"+strconv.Itoa(i), 1)
+	}
+
+	assert.Equal(t, 10, s.len(), "The sketch must never monitor more than its capacity")
+	assert.Len(t, s.counters, 10)
+	assert.GreaterOrEqual(t, s.estimate("heavy-1"), 5000.0*5)
+	assert.GreaterOrEqual(t, s.estimate("heavy-2"), 5000.0*3)
+	assert.Greater(t, s.estimate("heavy-1"), s.estimate("heavy-2"))
+}
+
+func TestSpaceSaving_EstimateLeavesOutInheritedWeight(t *testing.T) {
+	s := newSpaceSaving(2, 10*time.Minute)
+	s.add("heavy", 10)
+	s.add("filler", 9)
+
+	// The newcomer evicts "filler" and inherits its 9 on top of its own 2
+	s.add("new", 2)
+	assert.Equal(t, 2.0, s.estimate("new"))
+	assert.Greater(t, s.estimate("heavy"), s.estimate("new"))
+}
+
+func TestSpaceSaving_Decay(t *testing.T) {
+	s := newSpaceSaving(10, time.Minute)
+	start := time.Unix(0, 0)
+
+	s.decay(start)
+	s.add("old", 100)
+
+	// After one half-life the old weight counts half
+	s.decay(start.Add(time.Minute))
+	assert.InDelta(t, 50, s.estimate("old"), 1e-9)
+
+	// A process that is busy now overtakes one that was busy long ago
+	s.add("new", 30)
+	s.decay(start.Add(3 * time.Minute))
+	s.add("new", 30)
+	assert.Greater(t, s.estimate("new"), s.estimate("old"))
+	assert.Equal(t, 0.0, s.estimate("missing"))
+}
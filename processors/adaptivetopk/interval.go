@@ -0,0 +1,336 @@
+package adaptivetopk
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// intervalDecision is the selection settled by the first batch of a collection interval.
+// Later pieces of the same interval, e.g. after a batch processor split, reuse it.
+type intervalDecision struct {
+	timestamp pcommon.Timestamp
+	k         int
+	// procs holds every ranked process of the decision, including fallbacks
+	// from the previous interval, with its rank and reason.
+	procs map[string]*processInfo
+	// seen holds the processes that actually reported in this interval.
+	// They are the fallback candidates for the next interval.
+	seen map[string]*processInfo
+	// rankSelected counts the reported processes selected by rank. It and the fields below
+	// track the slots taken, to admit the newcomers of later pieces while slots are free.
+	// Fallbacks take a slot only once they report.
+	rankSelected int
+	// groupSelected counts them per group and groupK holds each group's K, with group_by.
+	groupSelected map[string]int
+	groupK        map[string]int
+	// budget holds the data points left with k_mode budget, and is nil otherwise.
+	budget *pointBudget
+	// rankingSelected counts the reported processes in the top of each additional ranking.
+	rankingSelected []int
+	// moversSelected counts the processes selected as movers.
+	moversSelected int
+}
+
+// decideForInterval returns the selection for the interval of batchTimestamp. The first batch
+// of an interval settles it, with the previous interval's processes as fallback candidates,
+// and later batches of the same interval reuse it. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) decideForInterval(ctx context.Context, batchTimestamp pcommon.Timestamp, allProcesses map[string]*processInfo, hostLoad float64) map[string]bool {
+	if d := p.currentDecision; d != nil && batchTimestamp <= d.timestamp {
+		// A later piece of the current interval, or a late piece of an older one
+		return p.reuseDecision(ctx, d, allProcesses)
+	}
+
+	// First batch of a new interval: rank it together with the processes
+	// of the previous interval that are not in this batch
+	candidates := make(map[string]*processInfo, len(allProcesses))
+	for key, proc := range allProcesses {
+		candidates[key] = proc
+	}
+	if prev := p.currentDecision; prev != nil {
+		for key, proc := range prev.seen {
+			if _, inBatch := candidates[key]; !inBatch {
+				candidates[key] = &processInfo{
+					key:            proc.key,
+					pid:            proc.pid,
+					group:          proc.group,
+					metricValue:    proc.metricValue,
+					secondaryValue: proc.secondaryValue,
+					rankings:       proc.rankings,
+					cost:           proc.cost,
+					isCritical:     proc.isCritical,
+					fallback:       true,
+				}
+			}
+		}
+	}
+
+	selected := p.decide(ctx, candidates, hostLoad)
+
+	d := &intervalDecision{
+		timestamp:       batchTimestamp,
+		k:               p.currentK(),
+		procs:           candidates,
+		seen:            make(map[string]*processInfo, len(allProcesses)),
+		groupSelected:   make(map[string]int),
+		groupK:          make(map[string]int),
+		rankingSelected: make([]int, len(p.config.Rankings)),
+	}
+	for key, proc := range allProcesses {
+		d.seen[key] = proc
+	}
+	if p.config.KMode == BudgetKMode {
+		d.budget = &pointBudget{remaining: p.config.DataPointBudget}
+	}
+	nonCritical := make([]*processInfo, 0, len(candidates))
+	groups := make(map[string][]*processInfo)
+	for _, proc := range candidates {
+		if !proc.isCritical {
+			nonCritical = append(nonCritical, proc)
+			groups[proc.group] = append(groups[proc.group], proc)
+		}
+		if proc.fallback || proc.reason == "" {
+			continue
+		}
+		switch proc.reason {
+		case reasonRank:
+			d.rankSelected++
+			d.groupSelected[proc.group]++
+		case reasonMover:
+			d.moversSelected++
+		}
+		if d.budget != nil {
+			d.budget.remaining -= proc.cost
+		}
+	}
+	if len(p.config.GroupByAttributes) > 0 {
+		for group, members := range groups {
+			d.groupK[group] = p.kFor(members, d.k)
+		}
+	}
+	for i := range p.config.Rankings {
+		for _, proc := range p.rankingTop(i, nonCritical) {
+			if !proc.fallback {
+				d.rankingSelected[i]++
+			}
+		}
+	}
+	p.currentDecision = d
+	return selected
+}
+
+// reuseDecision applies a settled decision to a later batch of the same interval. Critical
+// processes are always kept. Processes the decision has not seen, and fallbacks ranked on
+// their previous interval's values, are admitted only into free slots, under the same limits
+// as the first batch. Processes reporting for the first time in the interval update the
+// movers, heavy hitters, hysteresis and tenure state like the first batch does.
+// Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) reuseDecision(ctx context.Context, d *intervalDecision, allProcesses map[string]*processInfo) map[string]bool {
+	selected := make(map[string]bool, len(allProcesses))
+	newlySeen := make(map[string]*processInfo)
+	var newlySeenNonCritical []*processInfo
+	for key, proc := range allProcesses {
+		if _, seen := d.seen[key]; !seen {
+			newlySeen[key] = proc
+			if !proc.isCritical {
+				newlySeenNonCritical = append(newlySeenNonCritical, proc)
+			}
+		}
+	}
+	if p.heavyHitters != nil {
+		p.rankByHeavyHitters(newlySeenNonCritical)
+	}
+	if len(p.config.GroupByAttributes) > 0 {
+		// Groups new to the interval get their K like the groups of the first batch
+		newGroups := make(map[string][]*processInfo)
+		for _, proc := range newlySeenNonCritical {
+			if _, known := d.groupK[proc.group]; !known {
+				newGroups[proc.group] = append(newGroups[proc.group], proc)
+			}
+		}
+		for group, members := range newGroups {
+			d.groupK[group] = p.kFor(members, d.k)
+		}
+	}
+
+	var admitted int64
+	for _, key := range admissionOrder(d, allProcesses) {
+		proc := allProcesses[key]
+		decided, known := d.procs[key]
+		charged := false
+		switch {
+		case known && !competesForSlot(decided):
+			proc.rank = decided.rank
+			proc.reason = decided.reason
+		case !proc.isCritical:
+			if known {
+				proc.rank = decided.rank
+			}
+			charged = p.admit(d, proc)
+			if charged && (!known || decided.reason == "") {
+				admitted++
+			}
+		}
+		if proc.isCritical && proc.reason == "" {
+			proc.reason = reasonCritical
+		}
+		if proc.reason != "" {
+			selected[key] = true
+			if d.budget != nil && !charged {
+				// Points of this piece, on top of those the process already used
+				d.budget.remaining -= proc.cost
+			}
+		}
+		if _, isNew := newlySeen[key]; isNew {
+			d.seen[key] = proc
+			d.procs[key] = proc // No longer a fallback
+		}
+	}
+	if admitted > 0 {
+		p.obsrep.recordTopKProcessesSelected(ctx, admitted)
+	}
+	if len(newlySeen) == 0 {
+		return selected
+	}
+
+	if p.config.MoversCount > 0 {
+		d.moversSelected += p.selectMovers(newlySeenNonCritical, selected, p.config.MoversCount-d.moversSelected, d.budget)
+	}
+	if p.config.IsDynamicK() && p.config.HysteresisDuration > 0 {
+		now := time.Now()
+		for key, proc := range newlySeen {
+			if selected[key] {
+				p.processHysteresis[key] = now.Add(p.config.HysteresisDuration)
+			} else if expiry, held := p.processHysteresis[key]; held && now.Before(expiry) {
+				selected[key] = true
+				proc.reason = reasonHysteresis
+			}
+		}
+	}
+	entered, left, _ := p.trackTenures(ctx, newlySeen, selected, time.Now())
+	p.obsrep.recordSelectionChurn(ctx, entered, left)
+	return selected
+}
+
+// competesForSlot reports whether a process the decision knows competes for a free slot once
+// it reports: a fallback that was ranked on its previous interval's values.
+func competesForSlot(decided *processInfo) bool {
+	return decided.fallback && (decided.reason == "" || decided.reason == reasonRank ||
+		strings.HasPrefix(decided.reason, reasonRankingPrefix))
+}
+
+// admit selects proc if the decision has a free slot for it, by rank first, then by the
+// additional rankings it reports. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) admit(d *intervalDecision, proc *processInfo) bool {
+	if p.admitByRank(d, proc) {
+		proc.reason = reasonRank
+		return true
+	}
+	for i, r := range p.config.Rankings {
+		if proc.rankings[i].count > 0 && d.rankingSelected[i] < r.K && d.budget.take(proc) {
+			d.rankingSelected[i]++
+			proc.reason = reasonRankingPrefix + r.MetricName
+			return true
+		}
+	}
+	return false
+}
+
+// admitByRank takes a top K slot for proc if one is free: one of K, or of its group's K
+// within max_total_k with group_by, or the data points it needs with k_mode budget.
+func (p *adaptiveTopKProcessor) admitByRank(d *intervalDecision, proc *processInfo) bool {
+	switch {
+	case d.budget != nil:
+		if proc.metricValue <= 0 || !d.budget.take(proc) {
+			return false
+		}
+	case len(p.config.GroupByAttributes) > 0:
+		if d.groupSelected[proc.group] >= d.groupK[proc.group] {
+			return false
+		}
+		if p.config.MaxTotalK > 0 && d.rankSelected >= p.config.MaxTotalK {
+			return false
+		}
+		d.groupSelected[proc.group]++
+	default:
+		if d.rankSelected >= d.k {
+			return false
+		}
+	}
+	d.rankSelected++
+	return true
+}
+
+// selectedByPID returns the processes the decision keeps, by PID. Fallbacks that have not
+// reported in the interval are left out, as they hold no slot.
+func (d *intervalDecision) selectedByPID() map[string]*processInfo {
+	kept := make(map[string]*processInfo, len(d.procs))
+	for _, proc := range d.procs {
+		if proc.reason != "" && !proc.fallback {
+			kept[proc.pid] = proc
+		}
+	}
+	return kept
+}
+
+// admissionOrder returns the keys of a batch in the order they compete for free slots:
+// fallbacks the decision selected first, then the others by rank, or by ranking value per
+// data point with k_mode budget.
+func admissionOrder(d *intervalDecision, allProcesses map[string]*processInfo) []string {
+	keys := make([]string, 0, len(allProcesses))
+	for key := range allProcesses {
+		keys = append(keys, key)
+	}
+	wasSelected := func(key string) bool {
+		decided, known := d.procs[key]
+		return known && decided.reason != ""
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := wasSelected(keys[i]), wasSelected(keys[j]); a != b {
+			return a
+		}
+		a, b := allProcesses[keys[i]], allProcesses[keys[j]]
+		if d.budget != nil {
+			return denserThan(a, b)
+		}
+		return rankLess(b, a)
+	})
+	return keys
+}
+
+// collectionTimestamp returns the latest timestamp of the process data points in a batch,
+// which identifies the collection interval the batch belongs to.
+func collectionTimestamp(md pmetric.Metrics, entityKey string) pcommon.Timestamp {
+	var latest pcommon.Timestamp
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
+			sm := rm.ScopeMetrics().At(j)
+			for k := 0; k < sm.Metrics().Len(); k++ {
+				metric := sm.Metrics().At(k)
+				var dps pmetric.NumberDataPointSlice
+				switch metric.Type() {
+				case pmetric.MetricTypeGauge:
+					dps = metric.Gauge().DataPoints()
+				case pmetric.MetricTypeSum:
+					dps = metric.Sum().DataPoints()
+				default:
+					continue
+				}
+				for l := 0; l < dps.Len(); l++ {
+					dp := dps.At(l)
+					attrs := metricsutil.Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()}
+					if _, hasEntity := attrs.Get(entityKey); hasEntity && dp.Timestamp() > latest {
+						latest = dp.Timestamp()
+					}
+				}
+			}
+		}
+	}
+	return latest
+}
@@ -2,6 +2,9 @@ package adaptivetopk
 
 import (
 	"context"
+	"math"
+	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/otel/metric"
@@ -14,16 +17,34 @@ type adaptiveTopKObsreport struct {
 	settings              component.TelemetrySettings
 	processedPoints       metric.Int64Counter
 	droppedPoints         metric.Int64Counter
+	unidentifiedDropped   metric.Int64Counter
+	unselectedDropped     metric.Int64Counter
 	topKProcessesSelected metric.Int64Counter
 	currentKValue         metric.Int64Observable // For Dynamic K
-	currentVal            int64
+	currentVal            atomic.Int64           // Read by the meter callback on another goroutine
+	processesEntered      metric.Int64Counter
+	processesLeft         metric.Int64Counter
+	selectionTenure       metric.Float64Histogram
+	hysteresisHeld        metric.Int64Observable
+	hysteresisHeldVal     atomic.Int64
+	lastCriticalRank      metric.Int64Observable
+	lastCriticalRankVal   atomic.Int64
+	loadForecastError     metric.Float64Histogram
 }
 
 func newAdaptiveTopKObsreport(settings component.TelemetrySettings) (*adaptiveTopKObsreport, error) {
 	var processedPoints metric.Int64Counter
 	var droppedPoints metric.Int64Counter
+	var unidentifiedDropped metric.Int64Counter
+	var unselectedDropped metric.Int64Counter
 	var topKProcessesSelected metric.Int64Counter
 	var currentKValue metric.Int64Observable
+	var processesEntered metric.Int64Counter
+	var processesLeft metric.Int64Counter
+	var selectionTenure metric.Float64Histogram
+	var hysteresisHeld metric.Int64Observable
+	var lastCriticalRank metric.Int64Observable
+	var loadForecastError metric.Float64Histogram
 
 	// Create metrics if MeterProvider is available
 	if settings.MeterProvider != nil {
@@ -46,6 +67,22 @@ func newAdaptiveTopKObsreport(settings component.TelemetrySettings) (*adaptiveTo
 			return nil, err
 		}
 
+		unidentifiedDropped, err = meter.Int64Counter(
+			"otelcol_otelcol_adaptivetopk_unidentified_points_dropped_total",
+			metric.WithDescription("Number of data points of in-scope metrics dropped because they carry no process.pid or entity attributes"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		unselectedDropped, err = meter.Int64Counter(
+			"otelcol_otelcol_adaptivetopk_unselected_points_dropped_total",
+			metric.WithDescription("Number of data points dropped because their process was not selected"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
 		topKProcessesSelected, err = meter.Int64Counter(
 			"otelcol_otelcol_adaptivetopk_topk_processes_selected_total",
 			metric.WithDescription("Total number of non-critical processes selected for Top K in each batch"),
@@ -62,21 +99,81 @@ func newAdaptiveTopKObsreport(settings component.TelemetrySettings) (*adaptiveTo
 		if err != nil {
 			return nil, err
 		}
+
+		processesEntered, err = meter.Int64Counter(
+			"otelcol_otelcol_adaptivetopk_processes_entered_total",
+			metric.WithDescription("Number of processes that entered the selected set, per decision"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		processesLeft, err = meter.Int64Counter(
+			"otelcol_otelcol_adaptivetopk_processes_left_total",
+			metric.WithDescription("Number of processes that left the selected set, per decision"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		selectionTenure, err = meter.Float64Histogram(
+			"otelcol_otelcol_adaptivetopk_selection_tenure_seconds",
+			metric.WithDescription("How long processes stayed selected, recorded when they leave the selected set"),
+			metric.WithUnit("s"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		hysteresisHeld, err = meter.Int64ObservableGauge(
+			"otelcol_otelcol_adaptivetopk_hysteresis_held_processes",
+			metric.WithDescription("Number of processes selected only because of hysteresis in the latest decision"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		loadForecastError, err = meter.Float64Histogram(
+			"otelcol_otelcol_adaptivetopk_load_forecast_error",
+			metric.WithDescription("Absolute error of the host load forecast, recorded when the forecast load is observed (forecast_load only)"),
+			metric.WithExplicitBucketBoundaries(0.01, 0.02, 0.05, 0.1, 0.2, 0.5),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lastCriticalRank, err = meter.Int64ObservableGauge(
+			"otelcol_otelcol_adaptivetopk_last_critical_rank",
+			metric.WithDescription("Rank by key metric of the lowest ranked critical process in the latest decision, 0 if none"),
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	o := &adaptiveTopKObsreport{
 		settings:              settings,
 		processedPoints:       processedPoints,
 		droppedPoints:         droppedPoints,
+		unidentifiedDropped:   unidentifiedDropped,
+		unselectedDropped:     unselectedDropped,
 		topKProcessesSelected: topKProcessesSelected,
 		currentKValue:         currentKValue,
+		processesEntered:      processesEntered,
+		processesLeft:         processesLeft,
+		selectionTenure:       selectionTenure,
+		hysteresisHeld:        hysteresisHeld,
+		lastCriticalRank:      lastCriticalRank,
+		loadForecastError:     loadForecastError,
 	}
 
 	if settings.MeterProvider != nil {
 		_, err := settings.MeterProvider.Meter(processorName).RegisterCallback(func(ctx context.Context, obs metric.Observer) error {
-			obs.ObserveInt64(o.currentKValue, o.currentVal)
+			obs.ObserveInt64(o.currentKValue, o.currentVal.Load())
+			obs.ObserveInt64(o.hysteresisHeld, o.hysteresisHeldVal.Load())
+			obs.ObserveInt64(o.lastCriticalRank, o.lastCriticalRankVal.Load())
 			return nil
-		}, o.currentKValue)
+		}, o.currentKValue, o.hysteresisHeld, o.lastCriticalRank)
 		if err != nil {
 			return nil, err
 		}
@@ -104,6 +201,17 @@ func (o *adaptiveTopKObsreport) EndMetricsOp(ctx context.Context, _ string, numP
 	}
 }
 
+// recordDroppedPoints records why data points were dropped: no process identity, or a process
+// that was not selected
+func (o *adaptiveTopKObsreport) recordDroppedPoints(ctx context.Context, unidentified, unselected int64) {
+	if o.unidentifiedDropped != nil && unidentified > 0 {
+		o.unidentifiedDropped.Add(ctx, unidentified)
+	}
+	if o.unselectedDropped != nil && unselected > 0 {
+		o.unselectedDropped.Add(ctx, unselected)
+	}
+}
+
 // recordTopKProcessesSelected records the number of processes selected for Top K
 func (o *adaptiveTopKObsreport) recordTopKProcessesSelected(ctx context.Context, count int64) {
 	if o.topKProcessesSelected != nil {
@@ -113,5 +221,39 @@ func (o *adaptiveTopKObsreport) recordTopKProcessesSelected(ctx context.Context,
 
 // recordCurrentKValue records the current K value being used (for Dynamic K)
 func (o *adaptiveTopKObsreport) recordCurrentKValue(ctx context.Context, kValue int64) {
-	o.currentVal = kValue
+	o.currentVal.Store(kValue)
+}
+
+// recordSelectionChurn records how many processes entered and left the selected set in a decision
+func (o *adaptiveTopKObsreport) recordSelectionChurn(ctx context.Context, entered, left int64) {
+	if o.processesEntered != nil && entered > 0 {
+		o.processesEntered.Add(ctx, entered)
+	}
+	if o.processesLeft != nil && left > 0 {
+		o.processesLeft.Add(ctx, left)
+	}
+}
+
+// recordSelectionTenure records how long a process stayed selected before it left the set
+func (o *adaptiveTopKObsreport) recordSelectionTenure(ctx context.Context, tenure time.Duration) {
+	if o.selectionTenure != nil {
+		o.selectionTenure.Record(ctx, tenure.Seconds())
+	}
+}
+
+// recordHysteresisHeld records the number of processes held only by hysteresis
+func (o *adaptiveTopKObsreport) recordHysteresisHeld(_ context.Context, count int64) {
+	o.hysteresisHeldVal.Store(count)
+}
+
+// recordLastCriticalRank records the rank of the lowest ranked critical process
+func (o *adaptiveTopKObsreport) recordLastCriticalRank(_ context.Context, rank int64) {
+	o.lastCriticalRankVal.Store(rank)
+}
+
+// recordLoadForecastError records how far the observed host load was from its forecast
+func (o *adaptiveTopKObsreport) recordLoadForecastError(ctx context.Context, forecastErr float64) {
+	if o.loadForecastError != nil {
+		o.loadForecastError.Record(ctx, math.Abs(forecastErr))
+	}
 }
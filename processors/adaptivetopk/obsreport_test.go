@@ -33,10 +33,20 @@ func TestCurrentKValueCallback(t *testing.T) {
 	require.NoError(t, reader.Collect(context.Background(), &rm))
 
 	require.Len(t, rm.ScopeMetrics, 1)
-	sm := rm.ScopeMetrics[0]
-	require.Len(t, sm.Metrics, 1)
-	gauge, ok := sm.Metrics[0].Data.(metricdata.Gauge[int64])
+	gauge, ok := findMetric(rm, "otelcol_otelcol_adaptivetopk_current_k_value").Data.(metricdata.Gauge[int64])
 	require.True(t, ok)
 	require.Len(t, gauge.DataPoints, 1)
 	assert.Equal(t, int64(7), gauge.DataPoints[0].Value)
 }
+
+// findMetric returns the collected metric with the given name, or an empty one.
+func findMetric(rm metricdata.ResourceMetrics, name string) metricdata.Metrics {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	return metricdata.Metrics{}
+}
@@ -4,11 +4,18 @@ import (
 	"container/heap"
 	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/banding"
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
 	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/extension/experimental/storage"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/processor"
@@ -16,18 +23,97 @@ import (
 )
 
 const (
-	processExecutableNameKey = "process.executable.name"
-	processPIDKey            = "process.pid" // Assuming PID is available for unique identification
+	processExecutableNameKey = metricsutil.ProcessExecutableNameKey
+	processPIDKey            = metricsutil.ProcessPIDKey
 )
 
+// Reasons recorded for a selected process in annotate mode.
+const (
+	reasonCritical   = "critical"
+	reasonRank       = "rank"
+	reasonHysteresis = "hysteresis"
+	reasonMover      = "mover"
+	// Followed by the metric name of the additional ranking that selected the process
+	reasonRankingPrefix = "rank:"
+)
+
+// moverStaleAfter is how long a process's previous key metric value is kept for
+// mover detection after it was last reported.
+const moverStaleAfter = 5 * time.Minute
+
+// selectionStaleAfter is how long a selected process may go unreported before it is
+// considered to have left the selected set.
+const selectionStaleAfter = 5 * time.Minute
+
 // processInfo holds data for ranking processes
 type processInfo struct {
-	pid            string  // Unique process identifier (e.g., PID or command line hash)
+	key            string  // Process identity from metricsutil.ResolveProcessIdentities, survives PID reuse; the entity ID for other entities
+	pid            string  // PID the process reports in this batch, or the entity ID with entity_attributes
 	metricValue    float64 // Primary metric value for ranking
 	secondaryValue float64 // Secondary metric value for tie-breaking
-	attributes     pcommon.Map
+	primary        valueAccumulator
+	secondary      valueAccumulator
+	rankings       []valueAccumulator // Values of the additional rankings, by index in Config.Rankings
+	group          string             // Values of the group_by attributes, empty without grouping
+	cost           int                // In-scope data points of the process in the batch (budget mode only)
 	isCritical     bool
-	index          int // For heap interface
+	fallback       bool   // Carried over from the previous interval, not reported in this batch
+	rank           int    // 1-based rank among non-critical processes (annotate mode only)
+	reason         string // Why the process was selected, empty if it was not
+	index          int    // For heap interface
+}
+
+// valueAccumulator combines several data point values of one metric for one process.
+type valueAccumulator struct {
+	sum   float64
+	max   float64
+	count int
+}
+
+func (a *valueAccumulator) add(v float64) {
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+}
+
+// value returns the reduced value, or 0 if no data points were added.
+func (a *valueAccumulator) value(reducer Reducer) float64 {
+	if a.count == 0 {
+		return 0
+	}
+	switch reducer {
+	case MaxReducer:
+		return a.max
+	case MeanReducer:
+		return a.sum / float64(a.count)
+	default:
+		return a.sum
+	}
+}
+
+// matchesAttributes reports whether attrs contains every key/value pair of filter.
+func matchesAttributes(attrs metricsutil.Attributes, filter map[string]string) bool {
+	for key, want := range filter {
+		val, ok := attrs.Get(key)
+		if !ok || val.AsString() != want {
+			return false
+		}
+	}
+	return true
+}
+
+// rankLess reports whether a ranks below b by primary metric, then secondary metric, then PID.
+func rankLess(a, b *processInfo) bool {
+	if a.metricValue == b.metricValue {
+		// Tie-breaking logic using secondary metric
+		if a.secondaryValue == b.secondaryValue {
+			return a.pid < b.pid // Consistent tie-breaking by PID
+		}
+		return a.secondaryValue < b.secondaryValue
+	}
+	return a.metricValue < b.metricValue
 }
 
 // processHeap implements heap.Interface for processInfo
@@ -37,14 +123,7 @@ func (ph processHeap) Len() int { return len(ph) }
 func (ph processHeap) Less(i, j int) bool {
 	// Min-heap: we want to pop the smallest element
 	// For TopK largest, this means if element i is smaller than j, it has lower priority to stay in heap
-	if ph[i].metricValue == ph[j].metricValue {
-		// Tie-breaking logic using secondary metric
-		if ph[i].secondaryValue == ph[j].secondaryValue {
-			return ph[i].pid < ph[j].pid // Consistent tie-breaking by PID
-		}
-		return ph[i].secondaryValue < ph[j].secondaryValue
-	}
-	return ph[i].metricValue < ph[j].metricValue
+	return rankLess(ph[i], ph[j])
 }
 func (ph processHeap) Swap(i, j int) {
 	ph[i], ph[j] = ph[j], ph[i]
@@ -68,15 +147,52 @@ func (ph *processHeap) Pop() any {
 }
 
 type adaptiveTopKProcessor struct {
+	id           component.ID
 	config       *Config
 	logger       *zap.Logger
 	nextConsumer consumer.Metrics
 	obsrep       *adaptiveTopKObsreport
+	recorder     decisions.Recorder // Set in Start when an explain extension is configured
+	scope        *selectionScope    // Compiled include_metrics and exclude_metrics
+
+	// rankingsByMetric maps a metric name to the indexes of the additional rankings using it
+	rankingsByMetric map[string][]int
+
+	// eventsConsumer receives the selection events of the connector, nil for the processor
+	eventsConsumer consumer.Logs
 
 	// --- State for Dynamic K & Hysteresis (Sub-Phase 2b) ---
+	// mu guards the fields below, since the collector may call ConsumeMetrics concurrently.
+	mu                    sync.Mutex
 	currentDynamicK       int
-	processHysteresis     map[string]time.Time // processID -> expiryTime
-	lastHysteresisCleanup time.Time            // Track when we last did a full cleanup
+	bandMapper            *banding.LoadBandMapper // Only used with dynamic K
+	loadForecaster        *banding.HoltForecaster // Only used with forecast_load
+	processHysteresis     map[string]time.Time    // processID -> expiryTime
+	lastHysteresisCleanup time.Time               // Track when we last did a full cleanup
+	currentDecision       *intervalDecision       // Only used with per_interval_decisions
+	heavyHitters          *spaceSaving            // Only used with the heavy_hitters selection mode
+	previousValues        map[string]previousValue
+	selectedSince         map[string]selectionTenure
+	pendingEvents         []selectionEvent // Only queued with an events consumer
+
+	// Checkpointing, only used when storage is configured
+	storageClient   storage.Client
+	stopCheckpoint  chan struct{}
+	checkpointsDone chan struct{}
+}
+
+// selectionTenure is since when a process has been selected and when it was last reported,
+// for the churn and tenure metrics.
+type selectionTenure struct {
+	since time.Time
+	seen  time.Time
+	pid   string
+}
+
+// previousValue is the last reported key metric value of a process, for mover detection.
+type previousValue struct {
+	value float64
+	seen  time.Time
 }
 
 func newAdaptiveTopKProcessor(settings processor.CreateSettings, next consumer.Metrics, cfg *Config) (*adaptiveTopKProcessor, error) {
@@ -84,28 +200,58 @@ func newAdaptiveTopKProcessor(settings processor.CreateSettings, next consumer.M
 	if err != nil {
 		return nil, fmt.Errorf("failed to create obsreport for adaptivetopk processor: %w", err)
 	}
+	scope, err := newSelectionScope(cfg)
+	if err != nil {
+		return nil, err
+	}
 	p := &adaptiveTopKProcessor{
+		id:           settings.ID,
 		config:       cfg,
+		scope:        scope,
 		logger:       settings.Logger,
 		nextConsumer: next,
 		obsrep:       obsrep,
 	}
 	// Initialize hysteresis map and set initial cleanup time
 	p.processHysteresis = make(map[string]time.Time)
+	p.previousValues = make(map[string]previousValue)
+	p.selectedSince = make(map[string]selectionTenure)
 	p.lastHysteresisCleanup = time.Now()
+	p.rankingsByMetric = make(map[string][]int, len(cfg.Rankings))
+	for i, r := range cfg.Rankings {
+		p.rankingsByMetric[r.MetricName] = append(p.rankingsByMetric[r.MetricName], i)
+	}
 
 	// Set initial dynamic K value
 	if cfg.IsDynamicK() {
 		p.currentDynamicK = cfg.MinKValue // Initial K
+		p.bandMapper = newBandMapper(cfg, p.currentDynamicK)
+		if cfg.ForecastLoad {
+			p.loadForecaster = banding.NewHoltForecaster(cfg.ForecastAlpha, cfg.ForecastBeta)
+		}
+	} else if cfg.IsAdaptiveK() {
+		p.currentDynamicK = cfg.MinKValue // Until the first batch sets it
 	} else {
 		p.currentDynamicK = cfg.KValue // Use fixed K as initial dynamic K
 	}
+	if cfg.SelectionMode == HeavyHittersSelection {
+		p.heavyHitters = newSpaceSaving(cfg.HeavyHittersCapacity, cfg.HeavyHittersHalfLife)
+	}
 	p.obsrep.recordCurrentKValue(context.Background(), int64(p.currentDynamicK))
 	return p, nil
 }
 
-func (p *adaptiveTopKProcessor) Start(_ context.Context, _ component.Host) error { return nil }
-func (p *adaptiveTopKProcessor) Shutdown(_ context.Context) error                { return nil }
+func (p *adaptiveTopKProcessor) Start(ctx context.Context, host component.Host) error {
+	p.recorder = decisions.FindRecorder(host)
+	if p.config.Storage != nil {
+		return p.startCheckpoints(ctx, host)
+	}
+	return nil
+}
+
+func (p *adaptiveTopKProcessor) Shutdown(ctx context.Context) error {
+	return p.stopCheckpoints(ctx)
+}
 func (p *adaptiveTopKProcessor) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: true}
 }
@@ -114,25 +260,27 @@ func (p *adaptiveTopKProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 	ctx = p.obsrep.StartMetricsOp(ctx)
 	numOriginalMetricPoints := metricsutil.CountPoints(md)
 
-	// Determine current K value (fixed or dynamic)
-	currentK := p.config.KValue
-	if p.config.IsDynamicK() {
-		// Dynamic K calculation based on host metrics
-		hostLoad := p.findHostLoadMetric(md)
-		if hostLoad >= 0 {
-			if p.updateDynamicK(hostLoad) {
-				p.obsrep.recordCurrentKValue(ctx, int64(p.currentDynamicK))
-			}
-		}
-		currentK = p.currentDynamicK
+	// Find the host load for dynamic K; this only reads the batch (-1 if not configured)
+	hostLoad := p.findHostLoadMetric(md)
+
+	var batchTimestamp pcommon.Timestamp
+	if p.config.PerIntervalDecisions {
+		batchTimestamp = collectionTimestamp(md, p.config.entityAttributes()[0])
 	}
 
 	// Estimate process count for pre-allocation
 	// This helps reduce map resizing and improve performance
-	estimatedProcessCount := estimateProcessCount(md)
+	estimatedProcessCount := estimateProcessCount(md, p.config.entityAttributes()[0])
 
 	// Collect all processInfos from the batch with pre-allocated capacity
-	allProcesses := make(map[string]*processInfo, estimatedProcessCount) // PID -> processInfo
+	allProcesses := make(map[string]*processInfo, estimatedProcessCount) // Process identity -> processInfo
+
+	// Resolve each PID's identity once, so that a process whose identifying attributes are
+	// on only some of its data points is still one process
+	var identities metricsutil.ProcessIdentities
+	if p.config.isProcessEntity() {
+		identities = metricsutil.ResolveProcessIdentities(md)
+	}
 
 	for i := 0; i < md.ResourceMetrics().Len(); i++ {
 		rm := md.ResourceMetrics().At(i)
@@ -150,7 +298,8 @@ func (p *adaptiveTopKProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 				metricName := metric.Name()
 
 				// Skip metrics that aren't used for ranking or priority
-				if metricName != keyMetricName && metricName != secondaryKeyMetricName {
+				rankings := p.rankingsByMetric[metricName]
+				if metricName != keyMetricName && metricName != secondaryKeyMetricName && len(rankings) == 0 {
 					continue
 				}
 
@@ -166,24 +315,24 @@ func (p *adaptiveTopKProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 
 				for l := 0; l < dps.Len(); l++ {
 					dp := dps.At(l)
-					attrs := dp.Attributes()
-					pidVal, pidExists := attrs.Get(processPIDKey)
-					if !pidExists {
+					attrs := metricsutil.Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()}
+					key, id, identified := p.entityKey(identities, attrs)
+					if !identified {
 						continue // Skip data points not identifiable by PID
 					}
-					pid := pidVal.Str()
 
 					// Get or create process info
-					proc, exists := allProcesses[pid]
+					proc, exists := allProcesses[key]
 					if !exists {
 						proc = &processInfo{
-							pid:            pid,
-							attributes:     pcommon.NewMap(),
-							metricValue:    0,
-							secondaryValue: 0,
+							key:   key,
+							pid:   id,
+							group: p.groupKey(attrs),
 						}
-						dp.Attributes().CopyTo(proc.attributes) // Store all attributes
-						allProcesses[pid] = proc
+						if len(p.config.Rankings) > 0 {
+							proc.rankings = make([]valueAccumulator, len(p.config.Rankings))
+						}
+						allProcesses[key] = proc
 					}
 
 					// Check for critical tag
@@ -192,116 +341,673 @@ func (p *adaptiveTopKProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 						proc.isCritical = true
 					}
 
-					// Update metricValue if this is the key ranking metric
+					// Accumulate the key ranking metric, honoring the attribute filter
 					if metricName == keyMetricName {
-						proc.metricValue = getNumericValue(dp)
+						if matchesAttributes(attrs, p.config.KeyMetricAttributes) {
+							proc.primary.add(getNumericValue(dp))
+						}
 					} else if metricName == secondaryKeyMetricName {
-						// Update secondaryValue if this is the secondary ranking metric
-						proc.secondaryValue = getNumericValue(dp)
+						// Accumulate the secondary ranking metric
+						proc.secondary.add(getNumericValue(dp))
+					}
+					for _, i := range rankings {
+						if matchesAttributes(attrs, p.config.Rankings[i].Attributes) {
+							proc.rankings[i].add(getNumericValue(dp))
+						}
 					}
 				}
 			}
 		}
 	}
 
+	// Reduce the accumulated data points to one ranking value per process
+	for _, proc := range allProcesses {
+		proc.metricValue = proc.primary.value(p.config.KeyMetricReducer)
+		proc.secondaryValue = proc.secondary.value(p.config.KeyMetricReducer)
+	}
+	if p.config.KMode == BudgetKMode {
+		p.countPointCosts(md, allProcesses)
+	}
+
+	// Everything that reads or changes the shared selection state (current K, hysteresis)
+	// happens under p.mu. Collecting and filtering only touch this batch, so they run
+	// outside the lock and concurrent calls serialize only on the selection itself.
+	p.mu.Lock()
+	var selected map[string]bool
+	var settled map[string]*processInfo
+	if p.config.PerIntervalDecisions {
+		selected = p.decideForInterval(ctx, batchTimestamp, allProcesses, hostLoad)
+		settled = p.currentDecision.selectedByPID()
+	} else {
+		selected = p.decide(ctx, allProcesses, hostLoad)
+	}
+	events := p.takeEvents()
+	p.mu.Unlock()
+
+	if err := p.emitEvents(ctx, events); err != nil {
+		return err
+	}
+
+	if p.recorder != nil {
+		p.recordDecisions(allProcesses, selected)
+	}
+
+	// Decisions are per process identity. Within one batch a PID belongs to a single
+	// process, so the data points of the batch are matched to their process by PID.
+	procsByPID := make(map[string]*processInfo, len(allProcesses)+len(settled))
+	selectedPIDs := make(map[string]bool, len(selected)+len(settled))
+	// Processes kept for the interval stay kept in pieces without their ranking metrics
+	for pid, proc := range settled {
+		procsByPID[pid] = proc
+		selectedPIDs[pid] = true
+	}
+	for key, proc := range allProcesses {
+		procsByPID[proc.pid] = proc
+		if selected[key] {
+			selectedPIDs[proc.pid] = true
+		}
+	}
+
+	if p.config.IsAnnotateMode() {
+		// Keep every data point and tag it with the selection result
+		p.annotateMetrics(md, selectedPIDs, procsByPID)
+		p.obsrep.EndMetricsOp(ctx, p.config.ProcessorType(), numOriginalMetricPoints, 0, nil)
+		return p.nextConsumer.ConsumeMetrics(ctx, md)
+	}
+
+	// Filter in place (MutatesData is declared): remove data points, of every metric type in
+	// the selection scope, that don't belong to critical processes or topK processes
+	var unidentified, unselected int64
+	metricsutil.RemovePointsIf(md, func(metric pmetric.Metric, attrs metricsutil.Attributes) bool {
+		if !p.scope.contains(metric.Name()) {
+			return false // Not taking part in selection, pass through
+		}
+		id, identified := p.entityID(attrs)
+		if !identified {
+			unidentified++
+			return true
+		}
+		if !selectedPIDs[id] {
+			unselected++
+			return true
+		}
+		return false
+	})
+	p.obsrep.recordDroppedPoints(ctx, unidentified, unselected)
+
+	numProcessedMetricPoints := metricsutil.CountPoints(md)
+	numDroppedMetricPoints := numOriginalMetricPoints - numProcessedMetricPoints
+	p.obsrep.EndMetricsOp(ctx, p.config.ProcessorType(), numProcessedMetricPoints, numDroppedMetricPoints, nil)
+
+	return p.nextConsumer.ConsumeMetrics(ctx, md)
+}
+
+// decide selects the critical, top K, mover and hysteresis-held processes among procs,
+// setting each selected process's reason. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) decide(ctx context.Context, allProcesses map[string]*processInfo, hostLoad float64) map[string]bool {
+	// Determine current K value (fixed or dynamic)
+	if p.config.IsDynamicK() && hostLoad >= 0 {
+		// Dynamic K calculation based on host metrics
+		if p.loadForecaster != nil {
+			hostLoad = p.forecastLoad(ctx, hostLoad)
+		}
+		previousK, previousBand := p.currentDynamicK, p.bandMapper.GetCurrentBand()
+		if p.updateDynamicK(hostLoad) {
+			p.obsrep.recordCurrentKValue(ctx, int64(p.currentDynamicK))
+		}
+		if band := p.bandMapper.GetCurrentBand(); previousK != p.currentDynamicK || previousBand != band {
+			p.addEvent(selectionEvent{
+				name:      eventKChanged,
+				time:      time.Now(),
+				previousK: previousK,
+				k:         p.currentDynamicK,
+				band:      band,
+				hostLoad:  hostLoad,
+			})
+		}
+	}
+	currentK := p.currentK()
+
 	// Identify critical processes and Top K non-critical processes
 	// Pre-allocate maps and slices based on the number of processes
 	processCount := len(allProcesses)
-	selectedPIDs := make(map[string]bool, processCount)
+	selected := make(map[string]bool, processCount)
 	nonCriticalProcs := make([]*processInfo, 0, processCount)
+	criticalCost := 0
 
 	for _, proc := range allProcesses {
 		if proc.isCritical {
-			selectedPIDs[proc.pid] = true
+			selected[proc.key] = true
+			proc.reason = reasonCritical
+			criticalCost += proc.cost
 		} else {
 			nonCriticalProcs = append(nonCriticalProcs, proc)
 		}
 	}
 
-	// Pre-allocate the heap with exactly K capacity when possible
-	// This avoids heap resizing during the topK selection
-	heapCapacity := currentK
-	if len(nonCriticalProcs) < currentK {
-		heapCapacity = len(nonCriticalProcs)
-	}
-	topKHeap := make(processHeap, 0, heapCapacity)
-	heap.Init(&topKHeap)
+	// Before heavy hitters replaces the ranking values of the non-critical processes
+	criticalRank := lastCriticalRank(allProcesses)
 
-	var topKCount int64
+	if p.heavyHitters != nil {
+		p.rankByHeavyHitters(nonCriticalProcs)
+	}
 
-	// Optimization for the case where we have fewer processes than K
-	if len(nonCriticalProcs) <= currentK {
-		// If we have fewer or equal processes than K, simply include all of them
-		for _, proc := range nonCriticalProcs {
-			selectedPIDs[proc.pid] = true
+	var topK []*processInfo
+	var rankingsCount int64
+	if p.config.KMode == BudgetKMode {
+		// The additional rankings and movers are picked first, so that their data points
+		// count against the budget, and the top K fills what is left of it
+		budget := &pointBudget{remaining: p.config.DataPointBudget - criticalCost}
+		if p.ranksAll() {
+			rankAll(nonCriticalProcs, 0)
 		}
-		topKCount = int64(len(nonCriticalProcs))
-	} else {
-		// Use a min-heap to find Top K non-critical processes
+		rankingsCount = p.selectExtras(nonCriticalProcs, selected, budget)
+		unselected := make([]*processInfo, 0, len(nonCriticalProcs))
 		for _, proc := range nonCriticalProcs {
-			if topKHeap.Len() < currentK {
-				heap.Push(&topKHeap, proc)
-			} else if topKHeap.Len() > 0 && proc.metricValue > topKHeap[0].metricValue {
-				// Process has higher priority than the lowest one in the heap
-				heap.Pop(&topKHeap)
-				heap.Push(&topKHeap, proc)
+			if !selected[proc.key] {
+				unselected = append(unselected, proc)
 			}
 		}
-
-		// Extract the top K processes from the heap
-		count := 0
-		for topKHeap.Len() > 0 {
-			proc := heap.Pop(&topKHeap).(*processInfo)
-			selectedPIDs[proc.pid] = true
-			count++
-		}
-		topKCount = int64(count)
+		topK = p.selectWithinBudget(unselected, budget)
+	} else {
+		topK = p.selectNonCritical(nonCriticalProcs, currentK)
+	}
+	for _, proc := range topK {
+		selected[proc.key] = true
+		proc.reason = reasonRank
+	}
+	if p.config.IsAdaptiveK() && len(topK) != p.currentDynamicK {
+		p.currentDynamicK = len(topK)
+		p.obsrep.recordCurrentKValue(ctx, int64(p.currentDynamicK))
+	}
+	if p.config.KMode != BudgetKMode {
+		rankingsCount = p.selectExtras(nonCriticalProcs, selected, nil)
 	}
+	topKCount := int64(len(topK)) + rankingsCount
 
 	// Record metrics
 	p.obsrep.recordTopKProcessesSelected(ctx, topKCount)
 
 	// Apply hysteresis to processes if configured
 	if p.config.IsDynamicK() && p.config.HysteresisDuration > 0 {
-		p.applyProcessHysteresis(selectedPIDs, allProcesses)
+		p.applyProcessHysteresis(selected, allProcesses)
 	}
 
-	// Filter the original metrics
-	filteredMd := pmetric.NewMetrics()
-	md.ResourceMetrics().CopyTo(filteredMd.ResourceMetrics())
+	p.recordSelectionChanges(ctx, allProcesses, selected, criticalRank)
+	return selected
+}
 
-	// Remove metrics that don't belong to critical processes or topK processes
-	filteredMd.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
-		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
-			sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
-				switch metric.Type() {
-				case pmetric.MetricTypeGauge:
-					metric.Gauge().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
-						pidVal, pidExists := dp.Attributes().Get(processPIDKey)
-						return !pidExists || !selectedPIDs[pidVal.Str()]
-					})
-					return metric.Gauge().DataPoints().Len() == 0
-				case pmetric.MetricTypeSum:
-					metric.Sum().DataPoints().RemoveIf(func(dp pmetric.NumberDataPoint) bool {
-						pidVal, pidExists := dp.Attributes().Get(processPIDKey)
-						return !pidExists || !selectedPIDs[pidVal.Str()]
-					})
-					return metric.Sum().DataPoints().Len() == 0
-				default:
-					// For other metric types, pass them through unchanged
-					return false
-				}
-			})
-			return sm.Metrics().Len() == 0
-		})
-		return rm.ScopeMetrics().Len() == 0
+// recordSelectionChanges records the churn, tenure, hysteresis and critical rank metrics of
+// a decision. Only processes in the decision can enter or leave the selected set, so that
+// split batches don't count each other's processes as leaving. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) recordSelectionChanges(ctx context.Context, allProcesses map[string]*processInfo, selected map[string]bool, criticalRank int) {
+	now := time.Now()
+	entered, left, hysteresisHeld := p.trackTenures(ctx, allProcesses, selected, now)
+
+	// Selected processes that stopped reporting have left too
+	for key, tenure := range p.selectedSince {
+		if now.Sub(tenure.seen) > selectionStaleAfter {
+			left++
+			p.obsrep.recordSelectionTenure(ctx, tenure.seen.Sub(tenure.since))
+			delete(p.selectedSince, key)
+			p.addEvent(selectionEvent{name: eventProcessLeft, time: now, pid: tenure.pid, reason: leftStoppedReporting})
+		}
+	}
+
+	p.obsrep.recordSelectionChurn(ctx, entered, left)
+	p.obsrep.recordHysteresisHeld(ctx, hysteresisHeld)
+	p.obsrep.recordLastCriticalRank(ctx, int64(criticalRank))
+}
+
+// trackTenures starts the tenure of the processes of procs that entered the selected set and
+// ends it for those that left, returning how many entered and left and how many are held by
+// hysteresis. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) trackTenures(ctx context.Context, procs map[string]*processInfo, selected map[string]bool, now time.Time) (entered, left, hysteresisHeld int64) {
+	for key, proc := range procs {
+		tenure, wasSelected := p.selectedSince[key]
+		switch {
+		case selected[key]:
+			if !wasSelected {
+				entered++
+				tenure.since = now
+				p.addEvent(selectionEvent{name: eventProcessEntered, time: now, pid: proc.pid, rank: proc.rank, value: proc.metricValue, reason: proc.reason})
+			}
+			if !proc.fallback {
+				tenure.seen = now
+			}
+			tenure.pid = proc.pid
+			p.selectedSince[key] = tenure
+			if proc.reason == reasonHysteresis {
+				hysteresisHeld++
+			}
+		case wasSelected:
+			left++
+			p.obsrep.recordSelectionTenure(ctx, now.Sub(tenure.since))
+			delete(p.selectedSince, key)
+			p.addEvent(selectionEvent{name: eventProcessLeft, time: now, pid: proc.pid, rank: proc.rank, value: proc.metricValue, reason: leftNotSelected})
+		}
+	}
+	return entered, left, hysteresisHeld
+}
+
+// lastCriticalRank returns the rank by key metric that the lowest ranked critical process has
+// among all processes, or 0 when there is none. A rank above K means criticality kept a
+// process that the top K alone would have dropped.
+func lastCriticalRank(allProcesses map[string]*processInfo) int {
+	var last *processInfo
+	for _, proc := range allProcesses {
+		if proc.isCritical && (last == nil || rankLess(proc, last)) {
+			last = proc
+		}
+	}
+	if last == nil {
+		return 0
+	}
+	rank := 1
+	for _, proc := range allProcesses {
+		if rankLess(last, proc) {
+			rank++
+		}
+	}
+	return rank
+}
+
+// selectExtras keeps the top processes of the additional rankings and the movers that are not
+// selected yet, within budget unless it is nil. It returns how many the rankings added.
+// Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) selectExtras(procs []*processInfo, selected map[string]bool, budget *pointBudget) int64 {
+	var added int64
+	if len(p.config.Rankings) > 0 {
+		added = p.selectByRankings(procs, selected, budget)
+	}
+	if p.config.MoversCount > 0 {
+		p.selectMovers(procs, selected, p.config.MoversCount, budget)
+	}
+	return added
+}
+
+// selectByRankings keeps the top K processes of each additional ranking that are not selected
+// yet, and returns how many it added. Only processes reporting a ranking's metric take part in it.
+func (p *adaptiveTopKProcessor) selectByRankings(procs []*processInfo, selected map[string]bool, budget *pointBudget) int64 {
+	var added int64
+	for i, r := range p.config.Rankings {
+		for _, proc := range p.rankingTop(i, procs) {
+			if !selected[proc.key] && budget.take(proc) {
+				selected[proc.key] = true
+				proc.reason = reasonRankingPrefix + r.MetricName
+				added++
+			}
+		}
+	}
+	return added
+}
+
+// rankingTop returns the top K processes of procs by the additional ranking i.
+func (p *adaptiveTopKProcessor) rankingTop(i int, procs []*processInfo) []*processInfo {
+	r := p.config.Rankings[i]
+	reducer := r.Reducer
+	if reducer == "" {
+		reducer = p.config.KeyMetricReducer
+	}
+	ranked := make([]*processInfo, 0, len(procs))
+	values := make(map[*processInfo]float64, len(procs))
+	for _, proc := range procs {
+		if proc.rankings[i].count > 0 {
+			ranked = append(ranked, proc)
+			values[proc] = proc.rankings[i].value(reducer)
+		}
+	}
+	sort.Slice(ranked, func(a, b int) bool {
+		if values[ranked[a]] == values[ranked[b]] {
+			return ranked[a].pid < ranked[b].pid
+		}
+		return values[ranked[a]] > values[ranked[b]]
 	})
+	return ranked[:min(r.K, len(ranked))]
+}
 
-	numProcessedMetricPoints := metricsutil.CountPoints(filteredMd)
-	numDroppedMetricPoints := numOriginalMetricPoints - numProcessedMetricPoints
-	p.obsrep.EndMetricsOp(ctx, p.config.ProcessorType(), numProcessedMetricPoints, numDroppedMetricPoints, nil)
+// selectMovers keeps up to count unselected processes whose key metric changed the most since
+// it was last reported, within budget unless it is nil, then remembers the current values.
+// It returns the number of movers selected. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) selectMovers(procs []*processInfo, selected map[string]bool, count int, budget *pointBudget) int {
+	now := time.Now()
+
+	type mover struct {
+		proc  *processInfo
+		delta float64
+	}
+	movers := make([]mover, 0, len(procs))
+	for _, proc := range procs {
+		if proc.fallback {
+			continue // Not reported in this batch
+		}
+		// Use the reduced key metric itself, not a long-window ranking value
+		current := proc.primary.value(p.config.KeyMetricReducer)
+		if prev, ok := p.previousValues[proc.key]; ok && !selected[proc.key] {
+			movers = append(movers, mover{proc: proc, delta: math.Abs(current - prev.value)})
+		}
+		p.previousValues[proc.key] = previousValue{value: current, seen: now}
+	}
+
+	sort.Slice(movers, func(i, j int) bool {
+		if movers[i].delta == movers[j].delta {
+			return movers[i].proc.key < movers[j].proc.key
+		}
+		return movers[i].delta > movers[j].delta
+	})
+	chosen := 0
+	for _, m := range movers {
+		if chosen >= count || m.delta == 0 {
+			break
+		}
+		if !budget.take(m.proc) {
+			continue
+		}
+		selected[m.proc.key] = true
+		m.proc.reason = reasonMover
+		chosen++
+	}
+
+	// Forget processes that have not reported for a while
+	for key, prev := range p.previousValues {
+		if now.Sub(prev.seen) > moverStaleAfter {
+			delete(p.previousValues, key)
+		}
+	}
+	return chosen
+}
+
+// rankByHeavyHitters feeds the batch into the heavy-hitters sketch and replaces each
+// process's ranking value with its decayed long-window total. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) rankByHeavyHitters(procs []*processInfo) {
+	p.heavyHitters.decay(time.Now())
+	for _, proc := range procs {
+		if !proc.fallback { // Fallbacks were already counted in their own interval
+			p.heavyHitters.add(proc.key, proc.metricValue)
+		}
+	}
+	for _, proc := range procs {
+		proc.metricValue = p.heavyHitters.estimate(proc.key)
+	}
+}
+
+// currentK returns the fixed K, or the current dynamic K. With k_mode percentile or
+// coverage it is the K of the latest decision. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) currentK() int {
+	if p.config.IsDynamicK() || p.config.IsAdaptiveK() {
+		return p.currentDynamicK
+	}
+	return p.config.KValue
+}
+
+// selectNonCritical picks the top K non-critical processes, per group when group_by is set.
+func (p *adaptiveTopKProcessor) selectNonCritical(procs []*processInfo, k int) []*processInfo {
+	if len(p.config.GroupByAttributes) == 0 {
+		return p.selectFrom(procs, p.kFor(procs, k))
+	}
+
+	groups := make(map[string][]*processInfo)
+	for _, proc := range procs {
+		groups[proc.group] = append(groups[proc.group], proc)
+	}
+	selected := make([]*processInfo, 0, len(groups)*k)
+	for _, members := range groups {
+		selected = append(selected, p.selectFrom(members, p.kFor(members, k))...)
+	}
+
+	// Apply the optional global cap, keeping the highest ranked group winners
+	if p.config.MaxTotalK > 0 && len(selected) > p.config.MaxTotalK {
+		sort.Slice(selected, func(i, j int) bool { return rankLess(selected[j], selected[i]) })
+		selected = selected[:p.config.MaxTotalK]
+	}
+	return selected
+}
+
+// kFor returns how many of procs to select: k, or with k_mode percentile or coverage the
+// number derived from their ranking values, bounded by min_k_value and max_k_value.
+func (p *adaptiveTopKProcessor) kFor(procs []*processInfo, k int) int {
+	if !p.config.IsAdaptiveK() {
+		return k
+	}
+	values := make([]float64, len(procs))
+	for i, proc := range procs {
+		values[i] = proc.metricValue
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(values)))
+
+	k = 0
+	switch p.config.KMode {
+	case PercentileKMode:
+		// Nearest-rank percentile; keep every value strictly above it
+		if len(values) > 0 {
+			threshold := values[len(values)-int(math.Ceil(p.config.KPercentile*float64(len(values))))]
+			for k < len(values) && values[k] > threshold {
+				k++
+			}
+		}
+	case CoverageKMode:
+		total := 0.0
+		for _, v := range values {
+			if v > 0 {
+				total += v
+			}
+		}
+		covered := 0.0
+		for k < len(values) && total > 0 && covered < p.config.KCoverage*total {
+			covered += values[k]
+			k++
+		}
+	}
+	return max(p.config.MinKValue, min(k, p.config.MaxKValue))
+}
+
+// selectFrom returns the top k of procs. Annotate mode ranks every process, filter mode uses a heap.
+func (p *adaptiveTopKProcessor) selectFrom(procs []*processInfo, k int) []*processInfo {
+	if p.ranksAll() {
+		return rankAll(procs, k)
+	}
+	return selectTopK(procs, k)
+}
+
+// ranksAll reports whether every process needs a rank: annotate mode, the explain extension
+// and selection events report it.
+func (p *adaptiveTopKProcessor) ranksAll() bool {
+	return p.config.IsAnnotateMode() || p.recorder != nil || p.eventsConsumer != nil
+}
+
+// pointBudget holds the data points left to spend with k_mode budget.
+type pointBudget struct {
+	remaining int
+}
 
-	return p.nextConsumer.ConsumeMetrics(ctx, filteredMd)
+// take spends the data points of proc if they fit in the budget. A nil budget fits everything.
+func (b *pointBudget) take(proc *processInfo) bool {
+	if b == nil {
+		return true
+	}
+	if proc.cost > b.remaining {
+		return false
+	}
+	b.remaining -= proc.cost
+	return true
+}
+
+// selectWithinBudget picks the processes of procs covering the most ranking value with the
+// data points left in budget, and spends them. It adds them greedily by ranking value per data
+// point, unless the single most valuable process that fits covers more. Processes without a
+// positive ranking value are not worth any data points and are skipped.
+func (p *adaptiveTopKProcessor) selectWithinBudget(procs []*processInfo, budget *pointBudget) []*processInfo {
+	candidates := make([]*processInfo, 0, len(procs))
+	for _, proc := range procs {
+		if proc.metricValue > 0 && proc.cost <= budget.remaining {
+			candidates = append(candidates, proc)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return denserThan(candidates[i], candidates[j]) })
+
+	var selected []*processInfo
+	var covered float64
+	var best *processInfo
+	remaining := budget.remaining
+	for _, proc := range candidates {
+		if proc.cost <= remaining {
+			selected = append(selected, proc)
+			covered += proc.metricValue
+			remaining -= proc.cost
+		}
+		if best == nil || proc.metricValue > best.metricValue {
+			best = proc
+		}
+	}
+	if best != nil && best.metricValue > covered {
+		budget.remaining -= best.cost
+		return []*processInfo{best}
+	}
+	budget.remaining = remaining
+	return selected
+}
+
+// denserThan reports whether a covers more ranking value per data point than b, then ranks higher.
+func denserThan(a, b *processInfo) bool {
+	// Compares value per data point without dividing by a zero cost
+	densityA, densityB := a.metricValue*float64(b.cost), b.metricValue*float64(a.cost)
+	if densityA != densityB {
+		return densityA > densityB
+	}
+	return rankLess(b, a)
+}
+
+// countPointCosts sets the cost of each process to the number of its data points in md that
+// take part in selection.
+func (p *adaptiveTopKProcessor) countPointCosts(md pmetric.Metrics, allProcesses map[string]*processInfo) {
+	procsByPID := make(map[string]*processInfo, len(allProcesses))
+	for _, proc := range allProcesses {
+		procsByPID[proc.pid] = proc
+	}
+	metricsutil.RangePointAttributes(md, func(metric pmetric.Metric, attrs metricsutil.Attributes) {
+		if !p.scope.contains(metric.Name()) {
+			return
+		}
+		if id, ok := p.entityID(attrs); ok {
+			if proc, found := procsByPID[id]; found {
+				proc.cost++
+			}
+		}
+	})
+}
+
+// recordDecisions reports to the explain extension why each process of the batch was kept or dropped.
+func (p *adaptiveTopKProcessor) recordDecisions(allProcesses map[string]*processInfo, selected map[string]bool) {
+	batch := make([]decisions.Decision, 0, len(allProcesses))
+	for key, proc := range allProcesses {
+		d := decisions.Decision{
+			PID:    proc.pid,
+			Rank:   proc.rank,
+			Detail: fmt.Sprintf("%s=%g", p.config.KeyMetricName, proc.metricValue),
+		}
+		switch {
+		case !selected[key]:
+			d.Outcome = decisions.OutcomeDropped
+		case proc.reason == reasonCritical:
+			d.Outcome = decisions.OutcomeCritical
+		case proc.reason == reasonMover:
+			d.Outcome = decisions.OutcomeMover
+		case proc.reason == reasonHysteresis:
+			d.Outcome = decisions.OutcomeHysteresis
+		default:
+			// By rank, or by the rank in an additional ranking
+			d.Outcome = decisions.OutcomeTopK
+			if metricName, byRanking := strings.CutPrefix(proc.reason, reasonRankingPrefix); byRanking {
+				d.Detail += ", ranked by " + metricName
+			}
+		}
+		batch = append(batch, d)
+	}
+	p.recorder.RecordDecisions(p.id, batch)
+}
+
+// groupKey joins the group_by attribute values of a data point. Missing attributes count as empty.
+func (p *adaptiveTopKProcessor) groupKey(attrs metricsutil.Attributes) string {
+	if len(p.config.GroupByAttributes) == 0 {
+		return ""
+	}
+	key := ""
+	for _, name := range p.config.GroupByAttributes {
+		if val, ok := attrs.Get(name); ok {
+			key += val.AsString()
+		}
+		key += ";"
+	}
+	return key
+}
+
+// selectTopK returns the k highest ranked processes using a min-heap of size k.
+func selectTopK(procs []*processInfo, k int) []*processInfo {
+	// Optimization for the case where we have fewer processes than K
+	if len(procs) <= k {
+		return procs
+	}
+	if k <= 0 {
+		return nil
+	}
+
+	// Pre-allocate the heap with exactly K capacity
+	// This avoids heap resizing during the topK selection
+	topKHeap := make(processHeap, 0, k)
+	heap.Init(&topKHeap)
+	for _, proc := range procs {
+		if topKHeap.Len() < k {
+			heap.Push(&topKHeap, proc)
+		} else if rankLess(topKHeap[0], proc) {
+			// Process has higher priority than the lowest one in the heap
+			heap.Pop(&topKHeap)
+			heap.Push(&topKHeap, proc)
+		}
+	}
+	return topKHeap
+}
+
+// rankAll sorts procs from highest to lowest rank, records each process's 1-based rank,
+// and returns the first k of them.
+func rankAll(procs []*processInfo, k int) []*processInfo {
+	sort.Slice(procs, func(i, j int) bool { return rankLess(procs[j], procs[i]) })
+	for i, proc := range procs {
+		proc.rank = i + 1
+	}
+	if k < 0 {
+		k = 0
+	}
+	if len(procs) < k {
+		k = len(procs)
+	}
+	return procs[:k]
+}
+
+// annotateMetrics tags every data point, of every metric type in the selection scope, that carries
+// a PID with the selection result.
+func (p *adaptiveTopKProcessor) annotateMetrics(md pmetric.Metrics, selectedPIDs map[string]bool, procsByPID map[string]*processInfo) {
+	annotate := func(metric pmetric.Metric, attrs metricsutil.Attributes) {
+		if !p.scope.contains(metric.Name()) {
+			return // Not taking part in selection, leave untouched
+		}
+		pid, identified := p.entityID(attrs)
+		if !identified {
+			return // Not a process data point, leave untouched
+		}
+		attrs.Point.PutBool(p.config.SelectedAttributeName, selectedPIDs[pid])
+		proc, ranked := procsByPID[pid]
+		if !ranked {
+			return // No ranking metric seen for this process
+		}
+		if proc.rank > 0 {
+			attrs.Point.PutInt(p.config.RankAttributeName, int64(proc.rank))
+		}
+		if p.config.ReasonAttributeName != "" && proc.reason != "" {
+			attrs.Point.PutStr(p.config.ReasonAttributeName, proc.reason)
+		}
+	}
+
+	metricsutil.RangePointAttributes(md, annotate)
 }
 
 func getNumericValue(dp pmetric.NumberDataPoint) float64 {
@@ -385,27 +1091,30 @@ func (p *adaptiveTopKProcessor) findHostLoadMetric(md pmetric.Metrics) float64 {
 	return -1.0 // Metric not found
 }
 
-// updateDynamicK updates the current K value based on host load
-func (p *adaptiveTopKProcessor) updateDynamicK(hostLoad float64) bool {
-	// Find the appropriate K value based on load bands
-	newK := p.config.MinKValue // Default to minimum
-	highestThreshold := -1.0
-
-	// Find the highest threshold that's less than or equal to the current load
-	for threshold, kValue := range p.config.LoadBandsToKMap {
-		// Fix: Use threshold <= hostLoad to correctly match when load equals a threshold
-		if threshold <= hostLoad && threshold > highestThreshold {
-			highestThreshold = threshold
-			newK = kValue
-		}
+// forecastLoad adds the current host load to the forecaster, records the error of the previous
+// forecast and returns the load forecast for the next interval. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) forecastLoad(ctx context.Context, hostLoad float64) float64 {
+	if forecastErr, ok := p.loadForecaster.Observe(hostLoad); ok {
+		p.obsrep.recordLoadForecastError(ctx, forecastErr)
 	}
+	return math.Max(p.loadForecaster.Forecast(), 0)
+}
 
-	// Ensure K is within configured bounds
-	if newK < p.config.MinKValue {
-		newK = p.config.MinKValue
-	} else if newK > p.config.MaxKValue {
-		newK = p.config.MaxKValue
-	}
+// newBandMapper creates the load band mapper for dynamic K, stepping from initialK.
+func newBandMapper(cfg *Config, initialK int) *banding.LoadBandMapper {
+	return banding.NewLoadBandMapper(cfg.LoadBandsToKMap,
+		banding.WithBounds(cfg.MinKValue, cfg.MaxKValue),
+		banding.WithDownMargin(cfg.LoadBandHysteresis),
+		banding.WithHysteresis(cfg.MinBandDwell),
+		banding.WithMaxStep(cfg.MaxKStep),
+		banding.WithInitialValue(initialK))
+}
+
+// updateDynamicK updates the current K value based on host load. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) updateDynamicK(hostLoad float64) bool {
+	// The band mapper picks the band of the highest threshold <= load, clamps K to
+	// [min_k_value, max_k_value] and applies the band hysteresis, dwell time and K step
+	newK := p.bandMapper.GetKValueForLoad(hostLoad)
 
 	changed := newK != p.currentDynamicK
 	if changed && p.logger != nil {
@@ -420,15 +1129,15 @@ func (p *adaptiveTopKProcessor) updateDynamicK(hostLoad float64) bool {
 }
 
 // applyProcessHysteresis applies hysteresis to process selection
-// by keeping processes in the selectedPIDs map even after they fall out of the top K,
-// until their hysteresis period expires
-func (p *adaptiveTopKProcessor) applyProcessHysteresis(selectedPIDs map[string]bool, allProcesses map[string]*processInfo) {
+// by keeping processes in the selected map even after they fall out of the top K,
+// until their hysteresis period expires. Callers must hold p.mu.
+func (p *adaptiveTopKProcessor) applyProcessHysteresis(selected map[string]bool, allProcesses map[string]*processInfo) {
 	now := time.Now()
 
 	// Basic cleanup - remove only expired entries
-	for pid, expiryTime := range p.processHysteresis {
+	for key, expiryTime := range p.processHysteresis {
 		if now.After(expiryTime) {
-			delete(p.processHysteresis, pid)
+			delete(p.processHysteresis, key)
 		}
 	}
 
@@ -437,9 +1146,9 @@ func (p *adaptiveTopKProcessor) applyProcessHysteresis(selectedPIDs map[string]b
 	const fullCleanupInterval = 5 * time.Minute
 	if now.Sub(p.lastHysteresisCleanup) > fullCleanupInterval {
 		// Remove any hysteresis entries for processes that no longer exist in allProcesses
-		for pid := range p.processHysteresis {
-			if _, exists := allProcesses[pid]; !exists {
-				delete(p.processHysteresis, pid)
+		for key := range p.processHysteresis {
+			if _, exists := allProcesses[key]; !exists {
+				delete(p.processHysteresis, key)
 			}
 		}
 
@@ -452,17 +1161,18 @@ func (p *adaptiveTopKProcessor) applyProcessHysteresis(selectedPIDs map[string]b
 	}
 
 	// For processes currently selected, update or add their expiry time
-	for pid := range selectedPIDs {
-		p.processHysteresis[pid] = now.Add(p.config.HysteresisDuration)
+	for key := range selected {
+		p.processHysteresis[key] = now.Add(p.config.HysteresisDuration)
 	}
 
-	// Add processes still in their hysteresis period to the selected PIDs
+	// Add processes still in their hysteresis period to the selected processes
 	hysteresisCount := 0
-	for pid, expiryTime := range p.processHysteresis {
+	for key, expiryTime := range p.processHysteresis {
 		// Fix: Make sure we check if the process exists in allProcesses before applying hysteresis
 		// This ensures we don't omit processes that should be included due to hysteresis
-		if _, exists := allProcesses[pid]; exists && !selectedPIDs[pid] && now.Before(expiryTime) {
-			selectedPIDs[pid] = true
+		if proc, exists := allProcesses[key]; exists && !selected[key] && now.Before(expiryTime) {
+			selected[key] = true
+			proc.reason = reasonHysteresis
 			hysteresisCount++
 		}
 	}
@@ -470,13 +1180,13 @@ func (p *adaptiveTopKProcessor) applyProcessHysteresis(selectedPIDs map[string]b
 	if hysteresisCount > 0 && p.logger != nil {
 		p.logger.Debug("Applied process hysteresis",
 			zap.Int("hysteresisProcessCount", hysteresisCount),
-			zap.Int("totalSelectedProcesses", len(selectedPIDs)))
+			zap.Int("totalSelectedProcesses", len(selected)))
 	}
 }
 
 // estimateProcessCount estimates the number of unique processes in a metrics batch
-// by counting unique PIDs in the key metric's data points
-func estimateProcessCount(md pmetric.Metrics) int {
+// by counting unique values of entityKey, process.pid by default, in the key metric's data points
+func estimateProcessCount(md pmetric.Metrics, entityKey string) int {
 	// Default estimate if we can't determine better
 	defaultEstimate := 100
 
@@ -485,6 +1195,11 @@ func estimateProcessCount(md pmetric.Metrics) int {
 		return defaultEstimate
 	}
 
+	// Receivers that put process.pid on the resource, like hostmetrics, send one resource per process
+	if _, perResource := md.ResourceMetrics().At(0).Resource().Attributes().Get(entityKey); perResource {
+		return md.ResourceMetrics().Len()
+	}
+
 	// Keep track of unique PIDs
 	uniquePIDs := make(map[string]struct{})
 
@@ -518,9 +1233,9 @@ func estimateProcessCount(md pmetric.Metrics) int {
 				}
 
 				for l := 0; l < dps.Len(); l++ {
-					pidVal, exists := dps.At(l).Attributes().Get(processPIDKey)
+					pidVal, exists := dps.At(l).Attributes().Get(entityKey)
 					if exists {
-						uniquePIDs[pidVal.Str()] = struct{}{}
+						uniquePIDs[pidVal.AsString()] = struct{}{}
 					}
 				}
 			}
@@ -2,16 +2,23 @@ package adaptivetopk
 
 import (
 	"context"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
 	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/processor"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
 func TestAdaptiveTopK_FixedK(t *testing.T) {
@@ -489,6 +496,1314 @@ func TestProcessHysteresis(t *testing.T) {
 	// Process 2 is not in results because K=1 and process 1 has higher CPU
 }
 
+func TestAdaptiveTopK_AnnotateMode(t *testing.T) {
+	cfg := &Config{
+		Mode:                   AnnotateMode,
+		KValue:                 1,
+		KeyMetricName:          "process.cpu.utilization",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+		SelectedAttributeName:  "nr.topk.selected",
+		RankAttributeName:      "nr.topk.rank",
+		ReasonAttributeName:    "nr.topk.reason",
+	}
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, nextSink)
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.1).Attributes().PutStr("nr.priority", "critical")
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.5)
+	appendProcessGauge(sm, "process.cpu.utilization", "3", 0.3)
+	appendProcessGauge(sm, "process.memory.rss", "3", 1000)
+	appendProcessGauge(sm, "process.memory.rss", "4", 2000) // No ranking metric for PID 4
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	require.Len(t, nextSink.AllMetrics(), 1)
+	out := nextSink.AllMetrics()[0]
+	assert.Equal(t, 5, metricsutil.CountPoints(out), "Annotate mode must not drop any data points")
+
+	type annotation struct {
+		selected bool
+		rank     int64
+		reason   string
+	}
+	got := make(map[string]annotation)
+	ms := out.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := 0; i < ms.Len(); i++ {
+		attrs := ms.At(i).Gauge().DataPoints().At(0).Attributes()
+		pid, _ := attrs.Get(processPIDKey)
+		var a annotation
+		if v, ok := attrs.Get(cfg.SelectedAttributeName); ok {
+			a.selected = v.Bool()
+		}
+		if v, ok := attrs.Get(cfg.RankAttributeName); ok {
+			a.rank = v.Int()
+		}
+		if v, ok := attrs.Get(cfg.ReasonAttributeName); ok {
+			a.reason = v.Str()
+		}
+		got[ms.At(i).Name()+"/"+pid.Str()] = a
+	}
+
+	assert.Equal(t, annotation{selected: true, reason: reasonCritical}, got["process.cpu.utilization/1"])
+	assert.Equal(t, annotation{selected: true, rank: 1, reason: reasonRank}, got["process.cpu.utilization/2"])
+	assert.Equal(t, annotation{selected: false, rank: 2}, got["process.cpu.utilization/3"])
+	assert.Equal(t, annotation{selected: false, rank: 2}, got["process.memory.rss/3"])
+	assert.Equal(t, annotation{selected: false}, got["process.memory.rss/4"])
+}
+
+func TestAdaptiveTopK_GroupBy(t *testing.T) {
+	cfg := &Config{
+		KValue:                 2,
+		KeyMetricName:          "process.cpu.utilization",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+		GroupByAttributes:      []string{processExecutableNameKey},
+	}
+	require.NoError(t, cfg.Validate())
+
+	newBatch := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		// Five busy chrome renderers and three quieter python workers
+		for i, cpu := range []float64{0.9, 0.8, 0.7, 0.6, 0.5} {
+			dp := appendProcessGauge(sm, "process.cpu.utilization", "c"+string(rune('0'+i)), cpu)
+			dp.Attributes().PutStr(processExecutableNameKey, "chrome")
+		}
+		for i, cpu := range []float64{0.3, 0.2, 0.1} {
+			dp := appendProcessGauge(sm, "process.cpu.utilization", "p"+string(rune('0'+i)), cpu)
+			dp.Attributes().PutStr(processExecutableNameKey, "python")
+		}
+		return md
+	}
+
+	nextSink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, nextSink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), newBatch()))
+	assert.Equal(t, map[string]bool{"c0": true, "c1": true, "p0": true, "p1": true}, extractPIDs(nextSink.AllMetrics()[0]),
+		"Top 2 of each executable should be kept")
+
+	// With a global cap the highest ranked group winners are kept
+	cfg.MaxTotalK = 3
+	nextSink.Reset()
+	proc = newTestProcessor(t, cfg, nextSink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), newBatch()))
+	assert.Equal(t, map[string]bool{"c0": true, "c1": true, "p0": true}, extractPIDs(nextSink.AllMetrics()[0]))
+}
+
+func TestAdaptiveTopK_KeyMetricReducer(t *testing.T) {
+	// process.disk.io split by direction, with a different winner per reducer: PID 1 has the
+	// largest total, PID 2 the largest single point and PID 3 the largest mean
+	newBatch := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		m := sm.Metrics().AppendEmpty()
+		m.SetName("process.disk.io")
+		dps := m.SetEmptySum().DataPoints()
+		for _, p := range []struct {
+			pid       string
+			direction string
+			value     int64
+		}{
+			{"1", "read", 300}, {"1", "read", 300}, {"1", "read", 300}, {"1", "write", 300}, // sum 1200, max 300, mean 300
+			{"2", "read", 1000}, {"2", "write", 0}, // sum 1000, max 1000, mean 500
+			{"3", "write", 700}, // sum 700, max 700, mean 700
+		} {
+			dp := dps.AppendEmpty()
+			dp.SetIntValue(p.value)
+			dp.Attributes().PutStr(processPIDKey, p.pid)
+			dp.Attributes().PutStr("direction", p.direction)
+		}
+		return md
+	}
+
+	tests := []struct {
+		name       string
+		reducer    Reducer
+		attributes map[string]string
+		wantPID    string
+	}{
+		{name: "sum", reducer: SumReducer, wantPID: "1"},
+		{name: "max", reducer: MaxReducer, wantPID: "2"},
+		{name: "mean", reducer: MeanReducer, wantPID: "3"},
+		{name: "write only", reducer: SumReducer, attributes: map[string]string{"direction": "write"}, wantPID: "3"},
+		{name: "read only", reducer: SumReducer, attributes: map[string]string{"direction": "read"}, wantPID: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				KValue:                 1,
+				KeyMetricName:          "process.disk.io",
+				KeyMetricReducer:       tt.reducer,
+				KeyMetricAttributes:    tt.attributes,
+				PriorityAttributeName:  "nr.priority",
+				CriticalAttributeValue: "critical",
+			}
+			require.NoError(t, cfg.Validate())
+
+			nextSink := new(consumertest.MetricsSink)
+			proc := newTestProcessor(t, cfg, nextSink)
+			require.NoError(t, proc.ConsumeMetrics(context.Background(), newBatch()))
+			assert.Equal(t, map[string]bool{tt.wantPID: true}, extractPIDs(nextSink.AllMetrics()[0]))
+		})
+	}
+}
+
+func TestAdaptiveTopK_FiltersAllDataPointTypes(t *testing.T) {
+	cfg := &Config{
+		KValue:                 1,
+		KeyMetricName:          "process.cpu.utilization",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+	}
+	require.NoError(t, cfg.Validate())
+
+	reader := sdkmetric.NewManualReader()
+	settings := processor.CreateSettings{
+		ID: component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		},
+		BuildInfo: component.NewDefaultBuildInfo(),
+	}
+	nextSink := new(consumertest.MetricsSink)
+	proc, err := newAdaptiveTopKProcessor(settings, nextSink, cfg)
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.9)
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.1)
+	for _, pid := range []string{"1", "2"} {
+		sm.Metrics().AppendEmpty().SetEmptyHistogram().DataPoints().AppendEmpty().Attributes().PutStr(processPIDKey, pid)
+		sm.Metrics().AppendEmpty().SetEmptySummary().DataPoints().AppendEmpty().Attributes().PutStr(processPIDKey, pid)
+		sm.Metrics().AppendEmpty().SetEmptyExponentialHistogram().DataPoints().AppendEmpty().Attributes().PutStr(processPIDKey, pid)
+	}
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	out := nextSink.AllMetrics()[0]
+	assert.Equal(t, 4, metricsutil.CountPoints(out), "Only PID 1 should remain, one point per metric type")
+	assert.Equal(t, map[string]bool{"1": true}, extractPIDs(out))
+	metricsutil.RangePointAttributes(out, func(_ pmetric.Metric, attrs metricsutil.Attributes) {
+		pid, _ := attrs.Get(processPIDKey)
+		assert.Equal(t, "1", pid.Str())
+	})
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	var dropped int64
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		if m.Name == "otelcol_otelcol_processor_adaptivetopk_dropped_metric_points" {
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				dropped += dp.Value
+			}
+		}
+	}
+	assert.Equal(t, int64(4), dropped)
+}
+
+// TestAdaptiveTopK_ConcurrentConsumeMetrics exercises the shared dynamic K and hysteresis
+// state from several goroutines while the K gauge callback is collected. Run with -race.
+func TestAdaptiveTopK_ConcurrentConsumeMetrics(t *testing.T) {
+	cfg := &Config{
+		HostLoadMetricName:     "system.cpu.utilization",
+		LoadBandsToKMap:        map[float64]int{0.2: 5, 0.5: 10, 0.8: 20},
+		MinKValue:              5,
+		MaxKValue:              20,
+		HysteresisDuration:     time.Minute,
+		KeyMetricName:          "process.cpu.utilization",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+	}
+	require.NoError(t, cfg.Validate())
+
+	reader := sdkmetric.NewManualReader()
+	settings := processor.CreateSettings{
+		ID: component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		},
+		BuildInfo: component.NewDefaultBuildInfo(),
+	}
+	nextSink := new(consumertest.MetricsSink)
+	proc, err := newAdaptiveTopKProcessor(settings, nextSink, cfg)
+	require.NoError(t, err)
+
+	const workers = 8
+	const batchesPerWorker = 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < batchesPerWorker; i++ {
+				md := generateTestMetrics(40, 3, true)
+				// Vary the host load so that K changes between calls
+				hostDP := md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().At(0)
+				hostDP.SetDoubleValue(float64((w+i)%10) / 10)
+				assert.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < batchesPerWorker; i++ {
+			var rm metricdata.ResourceMetrics
+			assert.NoError(t, reader.Collect(context.Background(), &rm))
+		}
+	}()
+	wg.Wait()
+
+	assert.Len(t, nextSink.AllMetrics(), workers*batchesPerWorker)
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	assert.GreaterOrEqual(t, proc.currentDynamicK, cfg.MinKValue)
+	assert.LessOrEqual(t, proc.currentDynamicK, cfg.MaxKValue)
+}
+
+func TestAdaptiveTopK_PerIntervalDecisions(t *testing.T) {
+	cfg := &Config{
+		KValue:                 2,
+		KeyMetricName:          "process.cpu.utilization",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+		PerIntervalDecisions:   true,
+	}
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, nextSink)
+
+	// piece builds one part of a scrape that a batch processor split in two
+	piece := func(ts pcommon.Timestamp, values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", pid, v).SetTimestamp(ts)
+		}
+		return md
+	}
+	consume := func(md pmetric.Metrics) map[string]bool {
+		nextSink.Reset()
+		require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+		if len(nextSink.AllMetrics()) == 0 {
+			return map[string]bool{}
+		}
+		return extractPIDs(nextSink.AllMetrics()[0])
+	}
+
+	// Interval 1: the first piece settles the selection, the second piece reuses it
+	t1 := pcommon.Timestamp(1_000_000_000)
+	assert.Equal(t, map[string]bool{"1": true, "2": true}, consume(piece(t1, map[string]float64{"1": 0.9, "2": 0.1})))
+	assert.Equal(t, map[string]bool{}, consume(piece(t1, map[string]float64{"3": 0.8, "4": 0.7})),
+		"No more than K processes may be kept for one interval")
+
+	// Interval 2: the second piece's processes from interval 1 compete as fallback candidates
+	t2 := pcommon.Timestamp(2_000_000_000)
+	assert.Equal(t, map[string]bool{"1": true}, consume(piece(t2, map[string]float64{"1": 0.9, "2": 0.1})))
+	assert.Equal(t, map[string]bool{"3": true}, consume(piece(t2, map[string]float64{"3": 0.8, "4": 0.7})))
+
+	// Interval 3: PID 3 is kept as a fallback but stops reporting, so its slot goes to PID 4
+	t3 := pcommon.Timestamp(3_000_000_000)
+	assert.Equal(t, map[string]bool{"1": true}, consume(piece(t3, map[string]float64{"1": 0.9, "2": 0.1})))
+	assert.Equal(t, map[string]bool{"4": true}, consume(piece(t3, map[string]float64{"4": 0.7})))
+}
+
+func TestAdaptiveTopK_PerIntervalDecisionsKeepOtherMetrics(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 1
+	cfg.PerIntervalDecisions = true
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, nextSink)
+
+	// One scrape split into a piece with the key metric and a piece with only memory
+	ts := pcommon.Timestamp(1_000_000_000)
+	cpu := pmetric.NewMetrics()
+	sm := cpu.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.9).SetTimestamp(ts)
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.1).SetTimestamp(ts)
+	memory := pmetric.NewMetrics()
+	sm = memory.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.memory.rss", "1", 1000).SetTimestamp(ts)
+	appendProcessGauge(sm, "process.memory.rss", "2", 2000).SetTimestamp(ts)
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), cpu))
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), memory))
+	require.Len(t, nextSink.AllMetrics(), 2)
+	assert.Equal(t, map[string]bool{"1": true}, extractPIDs(nextSink.AllMetrics()[1]))
+	assert.Equal(t, 1, nextSink.AllMetrics()[1].DataPointCount())
+}
+
+func TestAdaptiveTopK_PerIntervalDecisionsLimits(t *testing.T) {
+	type process struct {
+		value  float64
+		group  string
+		points int // Data points, including the key metric's
+	}
+	newPiece := func(ts pcommon.Timestamp, procs map[string]process) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, proc := range procs {
+			dp := appendProcessGauge(sm, "process.cpu.utilization", pid, proc.value)
+			dp.SetTimestamp(ts)
+			dp.Attributes().PutStr("process.executable.name", proc.group)
+			for i := 1; i < proc.points; i++ {
+				appendProcessGauge(sm, "process.memory.usage", pid, 1000).SetTimestamp(ts)
+			}
+		}
+		return md
+	}
+
+	tests := []struct {
+		name string
+		cfg  func(cfg *Config)
+		// Intervals of pieces, each interval split into pieces
+		intervals [][]map[string]process
+		// Processes kept by each piece of the last interval, and its total data points
+		want       []map[string]bool
+		wantPoints int
+	}{
+		{
+			name: "group_by",
+			cfg: func(cfg *Config) {
+				cfg.KValue = 1
+				cfg.GroupByAttributes = []string{"process.executable.name"}
+			},
+			intervals: [][]map[string]process{{
+				{"1": {value: 0.9, group: "nginx", points: 1}, "2": {value: 0.5, group: "nginx", points: 1}},
+				{"3": {value: 0.8, group: "postgres", points: 1}, "4": {value: 0.7, group: "postgres", points: 1}},
+			}},
+			// As in one batch: the top process of each group
+			want:       []map[string]bool{{"1": true}, {"3": true}},
+			wantPoints: 2,
+		},
+		{
+			name: "data point budget",
+			cfg: func(cfg *Config) {
+				cfg.KMode = BudgetKMode
+				cfg.DataPointBudget = 4
+			},
+			intervals: [][]map[string]process{
+				{{"x": {value: 0.9, points: 1}, "y": {value: 0.8, points: 1}}},
+				// "y" is kept as a fallback and no longer reports; "w" does not fit in what is left
+				{{"x": {value: 0.9, points: 1}}, {"w": {value: 0.5, points: 4}}},
+			},
+			want:       []map[string]bool{{"x": true}, {}},
+			wantPoints: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			cfg.PerIntervalDecisions = true
+			tt.cfg(cfg)
+			require.NoError(t, cfg.Validate())
+
+			sink := new(consumertest.MetricsSink)
+			proc := newTestProcessor(t, cfg, sink)
+			for i, pieces := range tt.intervals {
+				sink.Reset()
+				ts := pcommon.Timestamp(i+1) * 1_000_000_000
+				for _, piece := range pieces {
+					require.NoError(t, proc.ConsumeMetrics(context.Background(), newPiece(ts, piece)))
+				}
+			}
+
+			require.Len(t, sink.AllMetrics(), len(tt.want))
+			points := 0
+			for i, want := range tt.want {
+				assert.Equal(t, want, extractPIDs(sink.AllMetrics()[i]), "piece %d", i)
+				points += sink.AllMetrics()[i].DataPointCount()
+			}
+			assert.Equal(t, tt.wantPoints, points)
+		})
+	}
+}
+
+func TestAdaptiveTopK_PerIntervalDecisionsTrackLaterPieces(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 1
+	cfg.MoversCount = 1
+	cfg.PerIntervalDecisions = true
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, nextSink)
+
+	piece := func(ts pcommon.Timestamp, pid string, v float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		appendProcessGauge(sm, "process.cpu.utilization", pid, v).SetTimestamp(ts)
+		return md
+	}
+	consume := func(md pmetric.Metrics) map[string]bool {
+		nextSink.Reset()
+		require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+		if len(nextSink.AllMetrics()) == 0 {
+			return map[string]bool{}
+		}
+		return extractPIDs(nextSink.AllMetrics()[0])
+	}
+
+	// PID 2 only ever reports in the second piece of an interval
+	t1 := pcommon.Timestamp(1_000_000_000)
+	assert.Equal(t, map[string]bool{"1": true}, consume(piece(t1, "1", 0.9)))
+	assert.Equal(t, map[string]bool{}, consume(piece(t1, "2", 0.1)))
+
+	// Its value was remembered, so its jump makes it a mover and starts its tenure
+	t2 := pcommon.Timestamp(2_000_000_000)
+	assert.Equal(t, map[string]bool{"1": true}, consume(piece(t2, "1", 0.9)))
+	assert.Equal(t, map[string]bool{"2": true}, consume(piece(t2, "2", 0.5)))
+
+	proc.mu.Lock()
+	defer proc.mu.Unlock()
+	assert.Len(t, proc.selectedSince, 2)
+}
+
+func TestAdaptiveTopK_HeavyHitters(t *testing.T) {
+	newCfg := func(mode SelectionMode) *Config {
+		cfg := createDefaultConfig().(*Config)
+		cfg.KValue = 1
+		cfg.SelectionMode = mode
+		require.NoError(t, cfg.Validate())
+		return cfg
+	}
+	batch := func(values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", pid, v)
+		}
+		return md
+	}
+
+	// PID 1 was very busy and is idle for a moment; PID 2 has a short spike
+	for _, tt := range []struct {
+		mode    SelectionMode
+		wantPID string
+	}{
+		{mode: TopKSelection, wantPID: "2"},
+		{mode: HeavyHittersSelection, wantPID: "1"},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			nextSink := new(consumertest.MetricsSink)
+			proc := newTestProcessor(t, newCfg(tt.mode), nextSink)
+			for i := 0; i < 5; i++ {
+				require.NoError(t, proc.ConsumeMetrics(context.Background(), batch(map[string]float64{"1": 0.9, "2": 0.1})))
+			}
+			nextSink.Reset()
+			require.NoError(t, proc.ConsumeMetrics(context.Background(), batch(map[string]float64{"1": 0.0, "2": 0.8})))
+			assert.Equal(t, map[string]bool{tt.wantPID: true}, extractPIDs(nextSink.AllMetrics()[0]))
+		})
+	}
+}
+
+func TestAdaptiveTopK_Movers(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 1
+	cfg.MoversCount = 2
+	require.NoError(t, cfg.Validate())
+
+	batch := func(values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", pid, v)
+		}
+		return md
+	}
+
+	nextSink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, nextSink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(),
+		batch(map[string]float64{"top": 0.9, "falling": 0.4, "rising": 0.001, "steady": 0.05, "new": 0.0})))
+
+	nextSink.Reset()
+	require.NoError(t, proc.ConsumeMetrics(context.Background(),
+		batch(map[string]float64{"top": 0.9, "falling": 0.0, "rising": 0.09, "steady": 0.06, "new": 0.0, "newer": 0.3})))
+
+	// "top" by rank, "falling" and "rising" as the two biggest movers; "newer" has no previous value
+	assert.Equal(t, map[string]bool{"top": true, "falling": true, "rising": true}, extractPIDs(nextSink.AllMetrics()[0]))
+}
+
+func TestAdaptiveTopK_HysteresisSurvivesOnlyTheSameProcess(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.5: 1}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 1
+	cfg.HysteresisDuration = time.Hour
+	require.NoError(t, cfg.Validate())
+
+	type process struct {
+		pid, executable string
+		started         pcommon.Timestamp
+		value           float64
+	}
+	batch := func(procs ...process) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		hostLoad := sm.Metrics().AppendEmpty()
+		hostLoad.SetName("system.cpu.utilization")
+		hostLoad.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(0.9)
+		for _, proc := range procs {
+			dp := appendProcessGauge(sm, "process.cpu.utilization", proc.pid, proc.value)
+			dp.Attributes().PutStr(processExecutableNameKey, proc.executable)
+			dp.Attributes().PutInt("process.create_time", int64(proc.started))
+		}
+		return md
+	}
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(),
+		batch(process{"7", "nginx", 100, 0.9}, process{"8", "java", 100, 0.5})))
+
+	// nginx keeps its hysteresis hold while it runs
+	require.NoError(t, proc.ConsumeMetrics(context.Background(),
+		batch(process{"7", "nginx", 100, 0.1}, process{"8", "java", 100, 0.5})))
+	assert.Equal(t, map[string]bool{"7": true, "8": true}, extractPIDs(sink.AllMetrics()[1]))
+
+	// A new process reusing PID 7 does not inherit it
+	require.NoError(t, proc.ConsumeMetrics(context.Background(),
+		batch(process{"7", "sh", 500, 0.1}, process{"8", "java", 100, 0.5})))
+	assert.Equal(t, map[string]bool{"8": true}, extractPIDs(sink.AllMetrics()[2]))
+}
+
+func TestAdaptiveTopK_GaugeAndSumOfOneProcess(t *testing.T) {
+	cfg := &Config{
+		KValue:                 1,
+		KeyMetricName:          "process.cpu.utilization",
+		SecondaryKeyMetricName: "process.memory.rss",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+	}
+	require.NoError(t, cfg.Validate())
+
+	// Equal CPU, so memory breaks the tie. The CPU gauge has no start time while the memory
+	// sum has one, as with cumulative receivers; both belong to the same process.
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.5)
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.5)
+	rss := sm.Metrics().AppendEmpty()
+	rss.SetName("process.memory.rss")
+	rss.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	for pid, value := range map[string]float64{"1": 1, "2": 1e9} {
+		dp := rss.Sum().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(value)
+		dp.SetStartTimestamp(1000)
+		dp.Attributes().PutStr(processPIDKey, pid)
+	}
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	assert.Equal(t, map[string]bool{"2": true}, extractPIDs(sink.AllMetrics()[0]))
+	assert.Equal(t, 2, sink.AllMetrics()[0].DataPointCount(), "the CPU and memory points of PID 2")
+}
+
+func TestAdaptiveTopK_IdentityAttributesOnSomePoints(t *testing.T) {
+	cfg := &Config{
+		KValue:                 1,
+		KeyMetricName:          "process.cpu.utilization",
+		SecondaryKeyMetricName: "process.memory.rss",
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+	}
+	require.NoError(t, cfg.Validate())
+
+	// Equal CPU, so memory breaks the tie. The executable name is on only one of each
+	// process's data points, which still belong to one process.
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.5).Attributes().PutStr(processExecutableNameKey, "nginx")
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.5)
+	rss := sm.Metrics().AppendEmpty()
+	rss.SetName("process.memory.rss")
+	rss.SetEmptySum().SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+	for pid, value := range map[string]float64{"1": 1e9, "2": 1} {
+		dp := rss.Sum().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(value)
+		dp.SetStartTimestamp(1000)
+		dp.Attributes().PutStr(processPIDKey, pid)
+		if pid == "2" {
+			dp.Attributes().PutStr(processExecutableNameKey, "java")
+		}
+	}
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	assert.Equal(t, map[string]bool{"1": true}, extractPIDs(sink.AllMetrics()[0]))
+	assert.Equal(t, 2, sink.AllMetrics()[0].DataPointCount(), "the CPU and memory points of PID 1")
+	assert.Len(t, proc.selectedSince, 1)
+}
+
+// appendHostmetricsProcess adds a resource shaped like the hostmetrics process scraper's output:
+// process.pid and process.executable.name on the resource, and a process.cpu.utilization
+// gauge with one data point per state.
+func appendHostmetricsProcess(md pmetric.Metrics, pid int64, executable string, user, system float64) {
+	rm := md.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutInt(processPIDKey, pid)
+	rm.Resource().Attributes().PutStr(processExecutableNameKey, executable)
+	sm := rm.ScopeMetrics().AppendEmpty()
+	cpu := sm.Metrics().AppendEmpty()
+	cpu.SetName("process.cpu.utilization")
+	dps := cpu.SetEmptyGauge().DataPoints()
+	for state, value := range map[string]float64{"user": user, "system": system} {
+		dp := dps.AppendEmpty()
+		dp.Attributes().PutStr("state", state)
+		dp.SetStartTimestamp(pcommon.Timestamp(pid * 1000))
+		dp.SetDoubleValue(value)
+	}
+	memory := sm.Metrics().AppendEmpty()
+	memory.SetName("process.memory.usage")
+	memory.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(1 << 20)
+}
+
+func TestAdaptiveTopK_HostmetricsResourceAttributes(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 2
+	require.NoError(t, cfg.Validate())
+
+	md := pmetric.NewMetrics()
+	appendHostmetricsProcess(md, 1, "nginx", 0.1, 0.05)
+	appendHostmetricsProcess(md, 2, "java", 0.5, 0.2)
+	appendHostmetricsProcess(md, 3, "sshd", 0.01, 0.01)
+	appendHostmetricsProcess(md, 4, "postgres", 0.3, 0.1)
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	out := sink.AllMetrics()[0]
+	require.Equal(t, 2, out.ResourceMetrics().Len(), "The top 2 processes should be kept with all their metrics")
+	kept := map[string]int{}
+	for i := 0; i < out.ResourceMetrics().Len(); i++ {
+		rm := out.ResourceMetrics().At(i)
+		pid, _ := rm.Resource().Attributes().Get(processPIDKey)
+		kept[pid.AsString()] = rm.ScopeMetrics().At(0).Metrics().Len()
+	}
+	assert.Equal(t, map[string]int{"2": 2, "4": 2}, kept)
+}
+
+func TestAdaptiveTopK_DynamicKBanding(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.2: 2, 0.5: 4}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 4
+	cfg.HysteresisDuration = 0
+	cfg.LoadBandHysteresis = 0.1
+	cfg.MaxKStep = 1
+	require.NoError(t, cfg.Validate())
+
+	proc := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	consumeAtLoad := func(load float64) int {
+		md := generateTestMetrics(6, 1, false)
+		md.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().At(0).SetDoubleValue(load)
+		require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+		proc.mu.Lock()
+		defer proc.mu.Unlock()
+		return proc.currentDynamicK
+	}
+
+	// K steps up one at a time from min_k_value towards the band's K
+	assert.Equal(t, 2, consumeAtLoad(0.6))
+	assert.Equal(t, 3, consumeAtLoad(0.6))
+	assert.Equal(t, 4, consumeAtLoad(0.6))
+	// A load just below the threshold stays in the band
+	assert.Equal(t, 4, consumeAtLoad(0.45))
+	// Past the margin K steps back down
+	assert.Equal(t, 3, consumeAtLoad(0.3))
+	assert.Equal(t, 2, consumeAtLoad(0.3))
+
+	cfg.MaxKStep = -1
+	assert.EqualError(t, cfg.Validate(), "max_k_step cannot be negative")
+}
+
+func TestAdaptiveTopK_ForecastLoad(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.5: 2, 0.8: 4}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 4
+	cfg.ForecastLoad = true
+	cfg.ForecastAlpha = 0.5
+	cfg.ForecastBeta = 0.5
+	require.NoError(t, cfg.Validate())
+
+	reader := sdkmetric.NewManualReader()
+	settings := processor.CreateSettings{
+		ID: component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		},
+		BuildInfo: component.NewDefaultBuildInfo(),
+	}
+	proc, err := newAdaptiveTopKProcessor(settings, new(consumertest.MetricsSink), cfg)
+	require.NoError(t, err)
+
+	consumeLoad := func(load float64) {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		hostLoad := sm.Metrics().AppendEmpty()
+		hostLoad.SetName("system.cpu.utilization")
+		hostLoad.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(load)
+		appendProcessGauge(sm, "process.cpu.utilization", "1", 0.5)
+		require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	}
+
+	consumeLoad(0.3)
+	assert.Equal(t, 1, proc.currentK())
+	// Rising from 0.3 to 0.5, the load is forecast to reach 0.7 next
+	consumeLoad(0.5)
+	assert.Equal(t, 2, proc.currentK())
+	// At 0.65 the rise continues, so K takes the 0.8 band a batch early
+	consumeLoad(0.65)
+	assert.Equal(t, 4, proc.currentK())
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	forecastErr := findMetric(rm, "otelcol_otelcol_adaptivetopk_load_forecast_error").Data.(metricdata.Histogram[float64])
+	require.Len(t, forecastErr.DataPoints, 1)
+	assert.Equal(t, uint64(2), forecastErr.DataPoints[0].Count)
+	assert.InDelta(t, 0.25, forecastErr.DataPoints[0].Sum, 1e-9) // |0.5-0.3| + |0.65-0.7|
+
+	cfg = createDefaultConfig().(*Config)
+	cfg.ForecastLoad = true
+	assert.EqualError(t, cfg.Validate(), "forecast_load requires host_load_metric_name")
+}
+
+func TestAdaptiveTopK_SelectionChurnMetrics(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 2
+	require.NoError(t, cfg.Validate())
+
+	reader := sdkmetric.NewManualReader()
+	settings := processor.CreateSettings{
+		ID: component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		},
+		BuildInfo: component.NewDefaultBuildInfo(),
+	}
+	proc, err := newAdaptiveTopKProcessor(settings, new(consumertest.MetricsSink), cfg)
+	require.NoError(t, err)
+
+	batch := func(values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, v := range values {
+			dp := appendProcessGauge(sm, "process.cpu.utilization", pid, v)
+			if pid == "c" {
+				dp.Attributes().PutStr(cfg.PriorityAttributeName, cfg.CriticalAttributeValue)
+			}
+		}
+		return md
+	}
+
+	// "a" and "b" enter with the critical "c", which ranks 4th of 4
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), batch(map[string]float64{"a": 0.9, "b": 0.8, "d": 0.3, "c": 0.1})))
+	// "d" replaces "b"
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), batch(map[string]float64{"a": 0.9, "b": 0.2, "d": 0.3, "c": 0.5})))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	sumOf := func(name string) int64 {
+		var total int64
+		for _, dp := range findMetric(rm, name).Data.(metricdata.Sum[int64]).DataPoints {
+			total += dp.Value
+		}
+		return total
+	}
+	assert.Equal(t, int64(4), sumOf("otelcol_otelcol_adaptivetopk_processes_entered_total"))
+	assert.Equal(t, int64(1), sumOf("otelcol_otelcol_adaptivetopk_processes_left_total"))
+
+	tenure := findMetric(rm, "otelcol_otelcol_adaptivetopk_selection_tenure_seconds").Data.(metricdata.Histogram[float64])
+	require.Len(t, tenure.DataPoints, 1)
+	assert.Equal(t, uint64(1), tenure.DataPoints[0].Count)
+
+	// In the second decision "c" ranks 2nd: a 0.9, c 0.5, d 0.3, b 0.2
+	rank := findMetric(rm, "otelcol_otelcol_adaptivetopk_last_critical_rank").Data.(metricdata.Gauge[int64])
+	assert.Equal(t, int64(2), rank.DataPoints[0].Value)
+	held := findMetric(rm, "otelcol_otelcol_adaptivetopk_hysteresis_held_processes").Data.(metricdata.Gauge[int64])
+	assert.Equal(t, int64(0), held.DataPoints[0].Value)
+}
+
+func TestAdaptiveTopK_SelectionScope(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	cfg.LoadBandsToKMap = map[float64]int{0.5: 1}
+	cfg.MinKValue = 1
+	cfg.MaxKValue = 1
+	cfg.ExcludeMetrics = []string{`process\.memory\..*`}
+	require.NoError(t, cfg.Validate())
+
+	reader := sdkmetric.NewManualReader()
+	settings := processor.CreateSettings{
+		ID: component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{
+			MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		},
+		BuildInfo: component.NewDefaultBuildInfo(),
+	}
+	sink := new(consumertest.MetricsSink)
+	proc, err := newAdaptiveTopKProcessor(settings, sink, cfg)
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	hostLoad := sm.Metrics().AppendEmpty()
+	hostLoad.SetName("system.cpu.utilization")
+	hostLoad.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(0.9)
+	memory := sm.Metrics().AppendEmpty()
+	memory.SetName("system.memory.usage")
+	memory.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(1 << 30)
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.9)
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.1)
+	appendProcessGauge(sm, "process.memory.utilization", "2", 0.5)
+	unidentified := sm.Metrics().AppendEmpty()
+	unidentified.SetName("process.threads")
+	unidentified.SetEmptySum().DataPoints().AppendEmpty().SetIntValue(4)
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	var names []string
+	out := sink.AllMetrics()[0].ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := 0; i < out.Len(); i++ {
+		names = append(names, out.At(i).Name())
+	}
+	// PID 2's CPU point and the unidentified process point are dropped; system metrics,
+	// including the host load, and the excluded memory metric pass through
+	assert.Equal(t, []string{"system.cpu.utilization", "system.memory.usage", "process.cpu.utilization", "process.memory.utilization"}, names)
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	sumOf := func(name string) int64 {
+		var total int64
+		for _, dp := range findMetric(rm, name).Data.(metricdata.Sum[int64]).DataPoints {
+			total += dp.Value
+		}
+		return total
+	}
+	assert.Equal(t, int64(1), sumOf("otelcol_otelcol_adaptivetopk_unidentified_points_dropped_total"))
+	assert.Equal(t, int64(1), sumOf("otelcol_otelcol_adaptivetopk_unselected_points_dropped_total"))
+	assert.Equal(t, int64(2), sumOf("otelcol_otelcol_processor_adaptivetopk_dropped_metric_points"))
+}
+
+func TestConfigValidate_SelectionScope(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.ExcludeMetrics = []string{"process.cpu.*"}
+	assert.EqualError(t, cfg.Validate(), `key_metric_name "process.cpu.utilization" must match include_metrics and not exclude_metrics`)
+
+	cfg = createDefaultConfig().(*Config)
+	cfg.IncludeMetrics = []string{"process.("}
+	assert.ErrorContains(t, cfg.Validate(), `invalid include_metrics pattern "process.("`)
+
+	cfg = createDefaultConfig().(*Config)
+	cfg.ExcludeMetrics = []string{""}
+	assert.EqualError(t, cfg.Validate(), "exclude_metrics cannot contain empty patterns")
+
+	// Patterns match the whole metric name, and are compiled by the processor whether or
+	// not Validate was called
+	cfg = createDefaultConfig().(*Config)
+	proc := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	assert.True(t, proc.scope.contains("process.memory.usage"))
+	assert.False(t, proc.scope.contains("system.process.count"))
+
+	cfg.ExcludeMetrics = []string{"process.memory.*"}
+	proc = newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	assert.False(t, proc.scope.contains("process.memory.usage"))
+}
+
+// decisionsRecorder is an extension that keeps the decisions it receives.
+type decisionsRecorder struct {
+	component.StartFunc
+	component.ShutdownFunc
+	mu       sync.Mutex
+	received map[string]decisions.Decision
+}
+
+func (r *decisionsRecorder) RecordDecisions(_ component.ID, batch []decisions.Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range batch {
+		r.received[d.PID] = d
+	}
+}
+
+type extensionsHost struct {
+	component.Host
+	extensions map[component.ID]component.Component
+}
+
+func (h extensionsHost) GetExtensions() map[component.ID]component.Component { return h.extensions }
+
+func TestAdaptiveTopK_RecordsDecisions(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 2
+	cfg.Rankings = []Ranking{{MetricName: "process.memory.usage", K: 1}}
+	require.NoError(t, cfg.Validate())
+
+	proc := newTestProcessor(t, cfg, new(consumertest.MetricsSink))
+	recorder := &decisionsRecorder{received: make(map[string]decisions.Decision)}
+	require.NoError(t, proc.Start(context.Background(), extensionsHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: map[component.ID]component.Component{component.NewID("explain"): recorder},
+	}))
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.01).Attributes().PutStr(cfg.PriorityAttributeName, cfg.CriticalAttributeValue)
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.9)
+	appendProcessGauge(sm, "process.cpu.utilization", "3", 0.5)
+	appendProcessGauge(sm, "process.cpu.utilization", "4", 0.1)
+	appendProcessGauge(sm, "process.cpu.utilization", "5", 0.05)
+	appendProcessGauge(sm, "process.memory.usage", "5", 1e9)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	assert.Equal(t, decisions.OutcomeCritical, recorder.received["1"].Outcome)
+	assert.Equal(t, decisions.OutcomeTopK, recorder.received["2"].Outcome)
+	assert.Equal(t, 1, recorder.received["2"].Rank)
+	assert.Equal(t, 2, recorder.received["3"].Rank)
+	assert.Equal(t, decisions.OutcomeDropped, recorder.received["4"].Outcome)
+	assert.Equal(t, 3, recorder.received["4"].Rank)
+	assert.Equal(t, "process.cpu.utilization=0.1", recorder.received["4"].Detail)
+	assert.Equal(t, decisions.OutcomeTopK, recorder.received["5"].Outcome)
+	assert.Equal(t, "process.cpu.utilization=0.05, ranked by process.memory.usage", recorder.received["5"].Detail)
+
+	// Every outcome is one that consumers of the explain extension can match
+	for _, d := range recorder.received {
+		assert.Contains(t, []string{decisions.OutcomeCritical, decisions.OutcomeTopK, decisions.OutcomeMover,
+			decisions.OutcomeHysteresis, decisions.OutcomeDropped}, d.Outcome)
+	}
+}
+
+func TestAdaptiveTopK_Rankings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 1
+	cfg.Mode = AnnotateMode
+	cfg.Rankings = []Ranking{
+		{MetricName: "process.memory.usage", K: 1},
+		{MetricName: "process.disk.io", K: 2, Attributes: map[string]string{"direction": "write"}},
+	}
+	require.NoError(t, cfg.Validate())
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	appendProcessGauge(sm, "process.cpu.utilization", "1", 0.9)
+	appendProcessGauge(sm, "process.cpu.utilization", "2", 0.1)
+	appendProcessGauge(sm, "process.cpu.utilization", "3", 0.2)
+	appendProcessGauge(sm, "process.cpu.utilization", "4", 0.3)
+	appendProcessGauge(sm, "process.memory.usage", "1", 9000) // Already kept by CPU, counted once
+	appendProcessGauge(sm, "process.memory.usage", "2", 8000)
+	appendProcessGauge(sm, "process.memory.usage", "5", 100) // Reports no CPU at all
+	appendProcessGauge(sm, "process.disk.io", "3", 50).Attributes().PutStr("direction", "write")
+	appendProcessGauge(sm, "process.disk.io", "5", 40).Attributes().PutStr("direction", "write")
+	appendProcessGauge(sm, "process.disk.io", "4", 1000).Attributes().PutStr("direction", "read")
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	reasons := make(map[string]string)
+	metricsutil.RangePointAttributes(sink.AllMetrics()[0], func(_ pmetric.Metric, attrs metricsutil.Attributes) {
+		pid, _ := attrs.Get(processPIDKey)
+		if reason, ok := attrs.Get("nr.topk.reason"); ok {
+			reasons[pid.Str()] = reason.Str()
+		}
+	})
+	// PID 1 leads memory too, so memory keeps no one else; disk writes keep PIDs 3 and 5
+	assert.Equal(t, map[string]string{
+		"1": reasonRank,
+		"3": "rank:process.disk.io",
+		"5": "rank:process.disk.io",
+	}, reasons)
+}
+
+func TestConfigValidate_Rankings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Rankings = []Ranking{{K: 5}}
+	assert.EqualError(t, cfg.Validate(), "rankings[0]: metric_name must be specified")
+
+	cfg.Rankings = []Ranking{{MetricName: "process.memory.usage"}}
+	assert.EqualError(t, cfg.Validate(), "rankings[0]: k must be positive")
+
+	cfg.Rankings = []Ranking{{MetricName: "process.memory.usage", K: 5, Reducer: "median"}}
+	assert.EqualError(t, cfg.Validate(), `invalid rankings[0].reducer "median", supported: sum, max, mean`)
+
+	cfg.Rankings = []Ranking{{MetricName: "system.memory.usage", K: 5}}
+	assert.EqualError(t, cfg.Validate(), `rankings[0]: metric_name "system.memory.usage" must match include_metrics and not exclude_metrics`)
+}
+
+func TestAdaptiveTopK_KMode(t *testing.T) {
+	// The values sum to 100, so the share of each process is its value in percent
+	values := []float64{50, 20, 10, 5, 5, 4, 3, 2, 1, 0}
+	newBatch := func() pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for i, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", strconv.Itoa(i), v)
+		}
+		return md
+	}
+
+	tests := []struct {
+		name       string
+		mode       KMode
+		percentile float64
+		coverage   float64
+		minK, maxK int
+		wantK      int
+	}{
+		{name: "above p90", mode: PercentileKMode, percentile: 0.9, maxK: 10, wantK: 1},
+		{name: "above p50", mode: PercentileKMode, percentile: 0.5, maxK: 10, wantK: 5},
+		{name: "percentile raised to min_k_value", mode: PercentileKMode, percentile: 0.9, minK: 2, maxK: 10, wantK: 2},
+		{name: "80% coverage", mode: CoverageKMode, coverage: 0.8, maxK: 10, wantK: 3},
+		{name: "coverage capped at max_k_value", mode: CoverageKMode, coverage: 1, maxK: 5, wantK: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			cfg.KMode = tt.mode
+			cfg.KPercentile = tt.percentile
+			cfg.KCoverage = tt.coverage
+			cfg.MinKValue = tt.minK
+			cfg.MaxKValue = tt.maxK
+			require.NoError(t, cfg.Validate())
+
+			sink := new(consumertest.MetricsSink)
+			proc := newTestProcessor(t, cfg, sink)
+			require.NoError(t, proc.ConsumeMetrics(context.Background(), newBatch()))
+			want := make(map[string]bool)
+			for i := 0; i < tt.wantK; i++ {
+				want[strconv.Itoa(i)] = true
+			}
+			assert.Equal(t, want, extractPIDs(sink.AllMetrics()[0]))
+			assert.Equal(t, tt.wantK, proc.currentK())
+		})
+	}
+}
+
+func TestAdaptiveTopK_DataPointBudgetWithMovers(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KMode = BudgetKMode
+	cfg.DataPointBudget = 4
+	cfg.MoversCount = 1
+	require.NoError(t, cfg.Validate())
+
+	// Every process reports two data points
+	batch := func(values map[string]float64) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, v := range values {
+			appendProcessGauge(sm, "process.cpu.utilization", pid, v)
+			appendProcessGauge(sm, "process.memory.usage", pid, 1000)
+		}
+		return md
+	}
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), batch(map[string]float64{"a": 0.9, "b": 0.5, "c": 0.001})))
+
+	// "c" jumps: as a mover it takes half of the budget and leaves room for "a" only
+	sink.Reset()
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), batch(map[string]float64{"a": 0.9, "b": 0.5, "c": 0.4})))
+	out := sink.AllMetrics()[0]
+	assert.Equal(t, map[string]bool{"a": true, "c": true}, extractPIDs(out))
+	assert.LessOrEqual(t, out.DataPointCount(), cfg.DataPointBudget)
+}
+
+func TestAdaptiveTopK_DataPointBudget(t *testing.T) {
+	type process struct {
+		value    float64
+		points   int // Data points in the batch, including the key metric's
+		critical bool
+	}
+	newBatch := func(procs map[string]process) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+		for pid, proc := range procs {
+			dp := appendProcessGauge(sm, "process.cpu.utilization", pid, proc.value)
+			if proc.critical {
+				dp.Attributes().PutStr("nr.priority", "critical")
+			}
+			for i := 1; i < proc.points; i++ {
+				appendProcessGauge(sm, "process.memory.usage", pid, 1000)
+			}
+		}
+		system := sm.Metrics().AppendEmpty()
+		system.SetName("system.memory.usage") // Out of scope, costs nothing
+		system.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(1)
+		return md
+	}
+
+	tests := []struct {
+		name   string
+		budget int
+		procs  map[string]process
+		want   map[string]bool
+	}{
+		{
+			name:   "most value per data point first",
+			budget: 6,
+			procs: map[string]process{
+				"a": {value: 0.9, points: 5},
+				"b": {value: 0.5, points: 2},
+				"c": {value: 0.4, points: 2},
+				"d": {value: 0.3, points: 1},
+				"e": {value: 0.1, points: 1, critical: true}, // Uses up one point of the budget
+			},
+			want: map[string]bool{"b": true, "c": true, "d": true, "e": true},
+		},
+		{
+			name:   "single process worth more than the greedy set",
+			budget: 5,
+			procs: map[string]process{
+				"a": {value: 0.9, points: 5},
+				"d": {value: 0.3, points: 1},
+			},
+			want: map[string]bool{"a": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			cfg.KMode = BudgetKMode
+			cfg.DataPointBudget = tt.budget
+			require.NoError(t, cfg.Validate())
+
+			sink := new(consumertest.MetricsSink)
+			proc := newTestProcessor(t, cfg, sink)
+			require.NoError(t, proc.ConsumeMetrics(context.Background(), newBatch(tt.procs)))
+			assert.Equal(t, tt.want, extractPIDs(sink.AllMetrics()[0]))
+			passedThrough := 0
+			metricsutil.RangePointAttributes(sink.AllMetrics()[0], func(metric pmetric.Metric, _ metricsutil.Attributes) {
+				if metric.Name() == "system.memory.usage" {
+					passedThrough++
+				}
+			})
+			assert.Equal(t, 1, passedThrough)
+		})
+	}
+
+	cfg := createDefaultConfig().(*Config)
+	cfg.KMode = BudgetKMode
+	assert.EqualError(t, cfg.Validate(), "data_point_budget must be positive when k_mode is budget")
+	cfg.DataPointBudget = 100
+	cfg.GroupByAttributes = []string{"process.executable.name"}
+	assert.EqualError(t, cfg.Validate(), "group_by cannot be used when k_mode is budget")
+}
+
+func TestAdaptiveTopK_EntityAttributes(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KValue = 1
+	cfg.KeyMetricName = "container.cpu.utilization"
+	cfg.IncludeMetrics = []string{`container\..*`}
+	cfg.EntityAttributes = []string{"k8s.pod.uid", "k8s.container.name"}
+	require.NoError(t, cfg.Validate())
+
+	// Shaped like kubeletstats: one resource per container
+	md := pmetric.NewMetrics()
+	appendContainer := func(pod, container string, cpu float64) {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("k8s.pod.uid", pod)
+		rm.Resource().Attributes().PutStr("k8s.container.name", container)
+		sm := rm.ScopeMetrics().AppendEmpty()
+		cpuMetric := sm.Metrics().AppendEmpty()
+		cpuMetric.SetName("container.cpu.utilization")
+		cpuMetric.SetEmptyGauge().DataPoints().AppendEmpty().SetDoubleValue(cpu)
+		memory := sm.Metrics().AppendEmpty()
+		memory.SetName("container.memory.usage")
+		memory.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(1000)
+	}
+	appendContainer("pod-1", "app", 0.2)
+	appendContainer("pod-1", "sidecar", 0.6)
+	appendContainer("pod-2", "app", 0.4)
+
+	sink := new(consumertest.MetricsSink)
+	proc := newTestProcessor(t, cfg, sink)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	kept := make(map[string]int)
+	metricsutil.RangePointAttributes(sink.AllMetrics()[0], func(_ pmetric.Metric, attrs metricsutil.Attributes) {
+		id, _ := proc.entityID(attrs)
+		kept[id]++
+	})
+	assert.Equal(t, map[string]int{"pod-1/sidecar": 2}, kept)
+	proc.mu.Lock()
+	assert.Contains(t, proc.selectedSince, "pod-1/sidecar", "state is keyed by the entity")
+	proc.mu.Unlock()
+
+	cfg.EntityAttributes = []string{"k8s.pod.uid", ""}
+	assert.EqualError(t, cfg.Validate(), "entity_attributes cannot contain empty strings")
+}
+
+func TestConfigValidate_KMode(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.KMode = "pareto"
+	assert.EqualError(t, cfg.Validate(), `invalid k_mode "pareto", supported: count, percentile, coverage, budget`)
+
+	cfg.KMode = PercentileKMode
+	cfg.KPercentile = 1
+	assert.EqualError(t, cfg.Validate(), "k_percentile must be between 0 and 1 when k_mode is percentile")
+
+	cfg.KMode = CoverageKMode
+	cfg.KCoverage = 0
+	assert.EqualError(t, cfg.Validate(), "k_coverage must be greater than 0 and at most 1 when k_mode is coverage")
+
+	cfg.KCoverage = 0.8
+	cfg.MaxKValue = 1
+	assert.EqualError(t, cfg.Validate(), "max_k_value must be greater than or equal to min_k_value when k_mode is coverage")
+
+	cfg.MaxKValue = 20
+	cfg.HostLoadMetricName = "system.cpu.utilization"
+	assert.EqualError(t, cfg.Validate(), "host_load_metric_name cannot be used when k_mode is coverage")
+}
+
+func TestConfigValidate_AnnotateMode(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Mode = AnnotateMode
+	require.NoError(t, cfg.Validate())
+
+	cfg.RankAttributeName = ""
+	assert.Error(t, cfg.Validate())
+
+	cfg.Mode = "sample"
+	assert.Error(t, cfg.Validate())
+}
+
+// newTestProcessor creates an adaptivetopk processor without logger or meter provider.
+func newTestProcessor(t *testing.T, cfg *Config, next *consumertest.MetricsSink) *adaptiveTopKProcessor {
+	settings := processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: component.TelemetrySettings{},
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	proc, err := newAdaptiveTopKProcessor(settings, next, cfg)
+	require.NoError(t, err)
+	return proc
+}
+
+// appendProcessGauge adds a single-point gauge for the given PID and returns the data point.
+func appendProcessGauge(sm pmetric.ScopeMetrics, name string, pid string, value float64) pmetric.NumberDataPoint {
+	m := sm.Metrics().AppendEmpty()
+	m.SetName(name)
+	dp := m.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetDoubleValue(value)
+	dp.Attributes().PutStr(processPIDKey, pid)
+	return dp
+}
+
 // Helper function to extract PIDs from metrics
 func extractPIDs(md pmetric.Metrics) map[string]bool {
 	foundPIDs := make(map[string]bool)
@@ -12,13 +12,34 @@ import (
 type AggregationType string
 
 const (
-	SumAggregation AggregationType = "sum"
-	AvgAggregation AggregationType = "avg"
-	// Future potential aggregation types
-	// MinAggregation AggregationType = "min"
-	// MaxAggregation AggregationType = "max"
+	SumAggregation   AggregationType = "sum"
+	AvgAggregation   AggregationType = "avg"
+	MinAggregation   AggregationType = "min"
+	MaxAggregation   AggregationType = "max"
+	CountAggregation AggregationType = "count" // Number of rolled-up data points
+	LastAggregation  AggregationType = "last"  // Value of the latest rolled-up data point
+	P50Aggregation   AggregationType = "p50"
+	P95Aggregation   AggregationType = "p95"
 )
 
+// supportedAggregations lists the aggregation types in error messages.
+const supportedAggregations = "sum, avg, min, max, count, last, p50, p95"
+
+// normalize returns the lower case aggregation type.
+func (a AggregationType) normalize() AggregationType {
+	return AggregationType(strings.ToLower(string(a)))
+}
+
+// isValid reports whether a is a supported aggregation type, in any case.
+func (a AggregationType) isValid() bool {
+	switch a.normalize() {
+	case SumAggregation, AvgAggregation, MinAggregation, MaxAggregation,
+		CountAggregation, LastAggregation, P50Aggregation, P95Aggregation:
+		return true
+	}
+	return false
+}
+
 // Config defines the configuration for the OthersRollup processor.
 type Config struct {
 	OutputPIDAttributeValue            string                     `mapstructure:"output_pid_attribute_value"`
@@ -27,7 +48,26 @@ type Config struct {
 	MetricsToRollup                    []string                   `mapstructure:"metrics_to_rollup"`
 	PriorityAttributeName              string                     `mapstructure:"priority_attribute_name"`
 	CriticalAttributeValue             string                     `mapstructure:"critical_attribute_value"`
-	// TopKAttributeName string `mapstructure:"topk_attribute_name"` // If adaptivetopk adds a tag
+	// TopKAttributeName is the attribute set by adaptivetopk in annotate mode. Data points
+	// where it is true are passed through instead of rolled up. Empty disables the check.
+	TopKAttributeName string `mapstructure:"topk_attribute_name"`
+	// AdditionalAggregations rolls a metric up several ways. Each additional aggregation is
+	// emitted as its own metric, named after the metric with the aggregation as a suffix
+	// (e.g. process.cpu.utilization.max next to the average in process.cpu.utilization).
+	AdditionalAggregations map[string][]AggregationType `mapstructure:"additional_aggregations"`
+	// EmitDistribution adds an exponential histogram of the rolled-up values of each metric,
+	// named after the metric with a .distribution suffix, to keep the shape of the long tail.
+	EmitDistribution bool `mapstructure:"emit_distribution"`
+	// DistributionMaxSize is the maximum number of buckets per sign of the histogram. The
+	// finest scale that fits is used, bounding the relative error of the buckets. 0 means 160.
+	DistributionMaxSize int `mapstructure:"distribution_max_size"`
+	// GroupBy rolls processes up into one series per distinct value of these attributes, such
+	// as process.executable.name or process.owner, instead of a single _other_ series.
+	GroupBy []string `mapstructure:"group_by"`
+	// MaxGroups caps the groups per resource and metric, keeping those with the largest
+	// aggregated values; processes of further groups, and processes missing a group_by
+	// attribute, roll up into _other_. 0 means 100.
+	MaxGroups int `mapstructure:"max_groups"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -51,13 +91,34 @@ func (cfg *Config) Validate() error {
 		if metric == "" {
 			return errors.New("metric name in aggregations cannot be empty")
 		}
-		switch strings.ToLower(string(agg)) {
-		case string(SumAggregation), string(AvgAggregation):
-			// valid
-		default:
-			return errors.New("invalid aggregation type for metric " + metric + ": " + string(agg) + ". Supported: sum, avg")
+		if !agg.isValid() {
+			return errors.New("invalid aggregation type for metric " + metric + ": " + string(agg) + ". Supported: " + supportedAggregations)
 		}
 	}
+	for metric, aggs := range cfg.AdditionalAggregations {
+		if metric == "" {
+			return errors.New("metric name in additional_aggregations cannot be empty")
+		}
+		for _, agg := range aggs {
+			if !agg.isValid() {
+				return errors.New("invalid additional aggregation type for metric " + metric + ": " + string(agg) + ". Supported: " + supportedAggregations)
+			}
+		}
+	}
+	if cfg.DistributionMaxSize < 0 {
+		return errors.New("distribution_max_size cannot be negative")
+	}
+	for _, name := range cfg.GroupBy {
+		if name == "" {
+			return errors.New("group_by attribute names cannot be empty")
+		}
+		if name == processPIDKey {
+			return errors.New("group_by cannot include " + processPIDKey + ", which would not roll anything up")
+		}
+	}
+	if cfg.MaxGroups < 0 {
+		return errors.New("max_groups cannot be negative")
+	}
 	return nil
 }
 
@@ -76,6 +137,12 @@ func (cfg *Config) Unmarshal(componentParser *confmap.Conf) error {
 	cfg.MetricsToRollup = []string{} // Default: rollup all compatible non-priority/TopK metrics
 	cfg.PriorityAttributeName = "nr.priority"
 	cfg.CriticalAttributeValue = "critical"
+	cfg.TopKAttributeName = ""
+	cfg.AdditionalAggregations = map[string][]AggregationType{}
+	cfg.EmitDistribution = false
+	cfg.DistributionMaxSize = defaultDistributionMaxSize
+	cfg.GroupBy = []string{}
+	cfg.MaxGroups = defaultMaxGroups
 
 	return componentParser.Unmarshal(cfg)
 }
@@ -8,3 +8,46 @@ func TestConfigProcessorType(t *testing.T) {
 		t.Errorf("expected othersrollup, got %s", got)
 	}
 }
+
+func TestConfigValidate_AdditionalAggregations(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "-1",
+		OutputExecutableNameAttributeValue: "_other_",
+		PriorityAttributeName:              "nr.priority",
+		CriticalAttributeValue:             "critical",
+		Aggregations:                       map[string]AggregationType{"process.cpu.utilization": "P95"},
+		AdditionalAggregations:             map[string][]AggregationType{"process.cpu.utilization": {"max", "last"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg.AdditionalAggregations["process.cpu.utilization"] = []AggregationType{"median"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for an unsupported additional aggregation")
+	}
+}
+
+func TestConfigValidate_GroupBy(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "-1",
+		OutputExecutableNameAttributeValue: "_other_",
+		PriorityAttributeName:              "nr.priority",
+		CriticalAttributeValue:             "critical",
+		GroupBy:                            []string{"process.owner"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cfg.GroupBy = []string{"process.pid"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for grouping by process.pid")
+	}
+
+	cfg.GroupBy = []string{"process.owner"}
+	cfg.MaxGroups = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an error for a negative max_groups")
+	}
+}
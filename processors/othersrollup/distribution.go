@@ -0,0 +1,140 @@
+package othersrollup
+
+import (
+	"math"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// distributionSuffix is appended to a metric name for the histogram of its rolled-up values.
+const distributionSuffix = ".distribution"
+
+// defaultDistributionMaxSize is the default number of buckets per sign of a distribution,
+// the OpenTelemetry SDK default for exponential histograms.
+const defaultDistributionMaxSize = 160
+
+// Scales of the exponential histogram, from the finest the specification allows to the
+// coarsest used here.
+const (
+	maxDistributionScale int32 = 20
+	minDistributionScale int32 = -10
+)
+
+// distributionMaxSize returns the maximum number of buckets per sign, 160 by default.
+func (cfg *Config) distributionMaxSize() int {
+	if cfg.DistributionMaxSize <= 0 {
+		return defaultDistributionMaxSize
+	}
+	return cfg.DistributionMaxSize
+}
+
+// bucketIndex returns the index of the exponential histogram bucket holding the positive
+// value v at scale: bucket i covers (base^i, base^(i+1)] with base = 2^(2^-scale).
+func bucketIndex(v float64, scale int32) int32 {
+	return int32(math.Ceil(math.Log2(v)*math.Ldexp(1, int(scale)))) - 1
+}
+
+// distributionScale returns the finest scale at which the magnitudes lo to hi fit in
+// maxSize buckets. Each bucket's upper bound is at most 2^(2^-scale) times its lower bound,
+// which bounds the relative error of any value read back from the histogram.
+func distributionScale(lo, hi float64, maxSize int) int32 {
+	scale := maxDistributionScale
+	for scale > minDistributionScale && int(bucketIndex(hi, scale)-bucketIndex(lo, scale)) >= maxSize {
+		scale--
+	}
+	return scale
+}
+
+// appendDistribution adds an exponential histogram of the rolled-up values of a metric to sm,
+// with the unit of the original metric, one data point per series.
+func (p *othersRollupProcessor) appendDistribution(sm pmetric.ScopeMetrics, name string, series []*AggregationState, originalMetricMetadata pmetric.Metric) {
+	distribution := sm.Metrics().AppendEmpty()
+	distribution.SetName(name + distributionSuffix)
+	distribution.SetDescription("Distribution of the values rolled up into " + name)
+	distribution.SetUnit(originalMetricMetadata.Unit())
+	histogram := distribution.SetEmptyExponentialHistogram()
+	histogram.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+
+	now := pcommon.NewTimestampFromTime(time.Now())
+	for _, aggState := range series {
+		dp := histogram.DataPoints().AppendEmpty()
+		dp.SetTimestamp(now)
+		p.fillDistribution(dp, aggState)
+	}
+}
+
+// fillDistribution fills dp with the histogram of the rolled-up values of one series. NaN and
+// infinite values have no bucket and are left out of the histogram, including its count, sum,
+// min and max.
+func (p *othersRollupProcessor) fillDistribution(dp pmetric.ExponentialHistogramDataPoint, aggState *AggregationState) {
+	dp.Attributes().PutStr(processPIDKey, p.config.OutputPIDAttributeValue)
+	dp.Attributes().PutStr(processExecutableNameKey, p.config.OutputExecutableNameAttributeValue)
+	p.putGroup(dp.Attributes(), aggState)
+
+	finite := make([]float64, 0, len(aggState.Values))
+	for _, v := range aggState.Values {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			finite = append(finite, v)
+		}
+	}
+	if len(finite) == 0 {
+		return
+	}
+
+	// One scale fits the magnitudes of both signs, as the data point has a single scale
+	sum, minValue, maxValue := 0.0, finite[0], finite[0]
+	minMagnitude, maxMagnitude := math.Inf(1), 0.0
+	for _, v := range finite {
+		sum += v
+		minValue = math.Min(minValue, v)
+		maxValue = math.Max(maxValue, v)
+		if v != 0 {
+			minMagnitude = math.Min(minMagnitude, math.Abs(v))
+			maxMagnitude = math.Max(maxMagnitude, math.Abs(v))
+		}
+	}
+	dp.SetCount(uint64(len(finite)))
+	dp.SetSum(sum)
+	dp.SetMin(minValue)
+	dp.SetMax(maxValue)
+	if maxMagnitude == 0 {
+		dp.SetZeroCount(uint64(len(finite)))
+		return
+	}
+	scale := distributionScale(minMagnitude, maxMagnitude, p.config.distributionMaxSize())
+	dp.SetScale(scale)
+
+	var positive, negative []uint64
+	offset := bucketIndex(minMagnitude, scale)
+	var zeroCount uint64
+	for _, v := range finite {
+		switch {
+		case v > 0:
+			positive = addToBucket(positive, bucketIndex(v, scale)-offset)
+		case v < 0:
+			negative = addToBucket(negative, bucketIndex(-v, scale)-offset)
+		default:
+			zeroCount++
+		}
+	}
+	dp.SetZeroCount(zeroCount)
+	if len(positive) > 0 {
+		dp.Positive().SetOffset(offset)
+		dp.Positive().BucketCounts().FromRaw(positive)
+	}
+	if len(negative) > 0 {
+		dp.Negative().SetOffset(offset)
+		dp.Negative().BucketCounts().FromRaw(negative)
+	}
+}
+
+// addToBucket increments the count of bucket i, growing buckets as needed.
+func addToBucket(buckets []uint64, i int32) []uint64 {
+	for int(i) >= len(buckets) {
+		buckets = append(buckets, 0)
+	}
+	buckets[i]++
+	return buckets
+}
@@ -32,6 +32,10 @@ func createDefaultConfig() component.Config {
 		MetricsToRollup:        []string{},
 		PriorityAttributeName:  "nr.priority",
 		CriticalAttributeValue: "critical",
+		AdditionalAggregations: map[string][]AggregationType{},
+		DistributionMaxSize:    defaultDistributionMaxSize,
+		GroupBy:                []string{},
+		MaxGroups:              defaultMaxGroups,
 	}
 }
 
@@ -0,0 +1,91 @@
+package othersrollup
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// defaultMaxGroups is the default maximum number of groups per resource and metric.
+const defaultMaxGroups = 100
+
+// maxGroups returns the maximum number of groups per resource and metric, 100 by default.
+func (cfg *Config) maxGroups() int {
+	if cfg.MaxGroups <= 0 {
+		return defaultMaxGroups
+	}
+	return cfg.MaxGroups
+}
+
+// rolledUpMetric holds the rolled-up series of one metric of a resource: one per group, and
+// the _other_ series for processes outside of any group.
+type rolledUpMetric struct {
+	metadata pmetric.Metric               // An original metric, for its unit, description and type
+	groups   map[string]*AggregationState // Group key -> AggregationState
+	other    *AggregationState            // nil until a data point rolls up into _other_
+}
+
+// groupOf returns the group a data point rolls up into, keyed by the values of the group_by
+// attributes. A nil values means the _other_ series: when group_by is empty or when an
+// attribute is missing.
+func (p *othersRollupProcessor) groupOf(attrs metricsutil.Attributes) (key string, values []string) {
+	if len(p.config.GroupBy) == 0 {
+		return "", nil
+	}
+	values = make([]string, len(p.config.GroupBy))
+	for i, name := range p.config.GroupBy {
+		val, found := attrs.Get(name)
+		if !found {
+			return "", nil
+		}
+		values[i] = val.AsString()
+	}
+	return strings.Join(values, "\x00"), values
+}
+
+// series returns the series of the metric in rank order, the _other_ series last. Only the
+// max_groups groups with the largest aggregated values keep a series of their own, so the
+// same groups are named from batch to batch however their data points are ordered; the
+// others are merged into _other_. It returns the number of data points merged that way.
+func (m *rolledUpMetric) series(maxGroups int) (series []*AggregationState, overflow int64) {
+	keys := make([]string, 0, len(m.groups))
+	for key := range m.groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := m.groups[keys[i]], m.groups[keys[j]]
+		if va, vb := math.Abs(a.value(a.Type)), math.Abs(b.value(b.Type)); va != vb {
+			return va > vb
+		}
+		return keys[i] < keys[j]
+	})
+
+	for i, key := range keys {
+		state := m.groups[key]
+		if i < maxGroups {
+			series = append(series, state)
+			continue
+		}
+		if m.other == nil {
+			m.other = &AggregationState{Metric: state.Metric, Type: state.Type, Additional: state.Additional, KeepValues: state.KeepValues}
+		}
+		m.other.merge(state)
+		overflow += state.Count
+	}
+	if m.other != nil {
+		series = append(series, m.other)
+	}
+	return series, overflow
+}
+
+// putGroup sets the group_by attributes of a rolled-up series of a group. A group on
+// process.executable.name replaces the _other_ executable name with the group's.
+func (p *othersRollupProcessor) putGroup(attrs pcommon.Map, aggState *AggregationState) {
+	for i, value := range aggState.Group {
+		attrs.PutStr(p.config.GroupBy[i], value)
+	}
+}
@@ -15,6 +15,7 @@ type othersRollupObsreport struct {
 	droppedPoints            metric.Int64Counter
 	aggregatedSeriesCount    metric.Int64Counter
 	inputSeriesRolledUpTotal metric.Int64Counter
+	groupOverflowPoints      metric.Int64Counter
 }
 
 func newOthersRollupObsreport(settings component.TelemetrySettings) (*othersRollupObsreport, error) {
@@ -22,6 +23,7 @@ func newOthersRollupObsreport(settings component.TelemetrySettings) (*othersRoll
 	var droppedPoints metric.Int64Counter
 	var aggregatedSeriesCount metric.Int64Counter
 	var inputSeriesRolledUpTotal metric.Int64Counter
+	var groupOverflowPoints metric.Int64Counter
 
 	// Create metrics if MeterProvider is available
 	if settings.MeterProvider != nil {
@@ -59,6 +61,14 @@ func newOthersRollupObsreport(settings component.TelemetrySettings) (*othersRoll
 		if err != nil {
 			return nil, err
 		}
+
+		groupOverflowPoints, err = meter.Int64Counter(
+			"otelcol_otelcol_othersrollup_group_overflow_total",
+			metric.WithDescription("Number of data points rolled up into _other_ because max_groups was reached."),
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &othersRollupObsreport{
@@ -67,6 +77,7 @@ func newOthersRollupObsreport(settings component.TelemetrySettings) (*othersRoll
 		droppedPoints:            droppedPoints,
 		aggregatedSeriesCount:    aggregatedSeriesCount,
 		inputSeriesRolledUpTotal: inputSeriesRolledUpTotal,
+		groupOverflowPoints:      groupOverflowPoints,
 	}, nil
 }
 
@@ -100,3 +111,9 @@ func (o *othersRollupObsreport) recordInputSeriesRolledUp(ctx context.Context, c
 		o.inputSeriesRolledUpTotal.Add(ctx, count)
 	}
 }
+
+func (o *othersRollupObsreport) recordGroupOverflow(ctx context.Context, count int64) {
+	if o.groupOverflowPoints != nil && count > 0 {
+		o.groupOverflowPoints.Add(ctx, count)
+	}
+}
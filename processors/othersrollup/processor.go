@@ -3,8 +3,12 @@ package othersrollup
 import (
 	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
 	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
@@ -15,22 +19,118 @@ import (
 )
 
 const (
-	processPIDKey            = "process.pid"
-	processExecutableNameKey = "process.executable.name"
+	processPIDKey            = metricsutil.ProcessPIDKey
+	processExecutableNameKey = metricsutil.ProcessExecutableNameKey
 )
 
 type othersRollupProcessor struct {
+	id           component.ID
 	config       *Config
 	logger       *zap.Logger
 	nextConsumer consumer.Metrics
 	obsrep       *othersRollupObsreport
+	recorder     decisions.Recorder // Set in Start when an explain extension is configured
 }
 
-// AggregationState holds the running sum and count for averaging.
+// AggregationState holds the running statistics of the rolled-up data points of one metric
+// and group.
 type AggregationState struct {
-	Sum   float64
-	Count int64
-	Type  AggregationType
+	Metric        string
+	Group         []string // Values of the group_by attributes, nil for the _other_ series
+	Sum           float64
+	Count         int64
+	Min           float64
+	Max           float64
+	Last          float64
+	LastTimestamp pcommon.Timestamp
+	Values        []float64 // Only kept for the p50 and p95 aggregations and distributions
+	Type          AggregationType
+	Additional    []AggregationType // Emitted as metrics suffixed with the aggregation
+	KeepValues    bool              // Whether Values are kept, set once when the state is created
+}
+
+// add adds a rolled-up data point value.
+func (s *AggregationState) add(value float64, timestamp pcommon.Timestamp) {
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	if s.Count == 0 || timestamp >= s.LastTimestamp {
+		s.Last = value
+		s.LastTimestamp = timestamp
+	}
+	s.Sum += value
+	s.Count++
+	if s.KeepValues {
+		s.Values = append(s.Values, value)
+	}
+}
+
+// value returns the aggregate of the rolled-up values. Percentiles are nearest-rank.
+func (s *AggregationState) value(agg AggregationType) float64 {
+	switch agg {
+	case AvgAggregation:
+		return s.Sum / float64(s.Count)
+	case MinAggregation:
+		return s.Min
+	case MaxAggregation:
+		return s.Max
+	case CountAggregation:
+		return float64(s.Count)
+	case LastAggregation:
+		return s.Last
+	case P50Aggregation:
+		return percentile(s.Values, 0.5)
+	case P95Aggregation:
+		return percentile(s.Values, 0.95)
+	default:
+		return s.Sum
+	}
+}
+
+// merge adds the rolled-up data points of other.
+func (s *AggregationState) merge(other *AggregationState) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	if s.Count == 0 || other.LastTimestamp >= s.LastTimestamp {
+		s.Last = other.Last
+		s.LastTimestamp = other.LastTimestamp
+	}
+	s.Sum += other.Sum
+	s.Count += other.Count
+	s.Values = append(s.Values, other.Values...)
+}
+
+// needsValues reports whether the aggregations need every rolled-up value.
+func (s *AggregationState) needsValues() bool {
+	if s.Type == P50Aggregation || s.Type == P95Aggregation {
+		return true
+	}
+	for _, agg := range s.Additional {
+		if agg == P50Aggregation || agg == P95Aggregation {
+			return true
+		}
+	}
+	return false
+}
+
+// percentile returns the nearest-rank percentile q of values, sorting them in place.
+func percentile(values []float64, q float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(q * float64(len(values))))
+	return values[max(rank, 1)-1]
 }
 
 func newOthersRollupProcessor(settings processor.CreateSettings, next consumer.Metrics, cfg *Config) (*othersRollupProcessor, error) {
@@ -39,6 +139,7 @@ func newOthersRollupProcessor(settings processor.CreateSettings, next consumer.M
 		return nil, fmt.Errorf("failed to create obsreport for othersrollup processor: %w", err)
 	}
 	return &othersRollupProcessor{
+		id:           settings.ID,
 		config:       cfg,
 		logger:       settings.Logger,
 		nextConsumer: next,
@@ -46,20 +147,34 @@ func newOthersRollupProcessor(settings processor.CreateSettings, next consumer.M
 	}, nil
 }
 
-func (p *othersRollupProcessor) Start(_ context.Context, _ component.Host) error { return nil }
-func (p *othersRollupProcessor) Shutdown(_ context.Context) error                { return nil }
+func (p *othersRollupProcessor) Start(_ context.Context, host component.Host) error {
+	p.recorder = decisions.FindRecorder(host)
+	return nil
+}
+
+func (p *othersRollupProcessor) Shutdown(_ context.Context) error { return nil }
 func (p *othersRollupProcessor) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: true}
 }
 
+// rollupResource collects the rolled-up series of the input resources that only differ in their
+// process attributes, such as the one resource per process of the hostmetrics process scraper.
+type rollupResource struct {
+	target    pmetric.ScopeMetrics         // Where the rolled-up metrics are emitted
+	metrics   map[string]*rolledUpMetric   // Metric name -> its rolled-up series
+	order     []string                     // Metric names in the order first seen, for stable output
+	processes map[string]map[string]string // Metric name -> process identity -> PID of the rolled-up processes
+}
+
 func (p *othersRollupProcessor) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
 	ctx = p.obsrep.StartMetricsOp(ctx)
 	originalMetricPointCount := metricsutil.CountPoints(md)
+	// Resolved once per PID, so every data point of a process has the same identity
+	identities := metricsutil.ResolveProcessIdentities(md)
 
-	// This map will store aggregated values: resourceKey -> metric_name -> AggregationState
-	rollupData := make(map[string]map[string]*AggregationState)
-	// This map tracks which original PIDs were part of the rollup for a given metric name under a resource
-	rolledUpPIDsPerMetric := make(map[string]map[string]map[string]bool) // resourceKey -> metricName -> PID -> true
+	// Rolled-up series per resource without process attributes
+	rollups := make(map[string]*rollupResource)
+	var rollupOrder []*rollupResource
 
 	newMetrics := pmetric.NewMetrics() // Holds pass-through and new rolled-up metrics
 
@@ -67,16 +182,9 @@ func (p *othersRollupProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 		rm := md.ResourceMetrics().At(i)
 		newRm := newMetrics.ResourceMetrics().AppendEmpty() // Create a new RM for the output
 		rm.Resource().CopyTo(newRm.Resource())
-		// Generate a resource key based on attributes
-		resourceKey := resourceAttributesToString(rm.Resource().Attributes())
-
-		// Initialize maps for the current resource if they don't exist
-		if _, ok := rollupData[resourceKey]; !ok {
-			rollupData[resourceKey] = make(map[string]*AggregationState)
-		}
-		if _, ok := rolledUpPIDsPerMetric[resourceKey]; !ok {
-			rolledUpPIDsPerMetric[resourceKey] = make(map[string]map[string]bool)
-		}
+		// Generate a resource key based on attributes, leaving out those of the process
+		rollupAttrs := rollupResourceAttributes(rm.Resource().Attributes())
+		resourceKey := resourceAttributesToString(rollupAttrs)
 
 		for j := 0; j < rm.ScopeMetrics().Len(); j++ {
 			sm := rm.ScopeMetrics().At(j)
@@ -89,10 +197,15 @@ func (p *othersRollupProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 				// This avoids creating empty metrics if all DPs are rolled up and the metric itself doesn't get a rollup.
 
 				// Function to determine if a metric datapoint should be rolled up
-				shouldRollupDP := func(attrs pcommon.Map) bool {
+				shouldRollupDP := func(attrs metricsutil.Attributes) bool {
 					if prioVal, prioExists := attrs.Get(p.config.PriorityAttributeName); prioExists && prioVal.Str() == p.config.CriticalAttributeValue {
 						return false
 					}
+					if p.config.TopKAttributeName != "" {
+						if topKVal, topKExists := attrs.Get(p.config.TopKAttributeName); topKExists && topKVal.AsString() == "true" {
+							return false // Selected by adaptivetopk
+						}
+					}
 					if len(p.config.MetricsToRollup) > 0 {
 						isTargeted := false
 						for _, mtr := range p.config.MetricsToRollup {
@@ -112,33 +225,76 @@ func (p *othersRollupProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 
 				passThroughDps := pmetric.NewNumberDataPointSlice() // Collect DPs that are not rolled up for this metric
 
+				// rollupFor returns the rollup of this resource, creating it on its first rolled-up point.
+				// Rolled-up series of a resource without process attributes join its pass-through
+				// metrics; others get a resource of their own, shared by all processes.
+				rollupFor := func() *rollupResource {
+					rollup, ok := rollups[resourceKey]
+					if !ok {
+						rollup = &rollupResource{
+							metrics:   make(map[string]*rolledUpMetric),
+							processes: make(map[string]map[string]string),
+						}
+						if rollupAttrs.Len() == rm.Resource().Attributes().Len() {
+							rollup.target = newSm
+						} else {
+							rollupRm := newMetrics.ResourceMetrics().AppendEmpty()
+							rollupAttrs.CopyTo(rollupRm.Resource().Attributes())
+							rollup.target = rollupRm.ScopeMetrics().AppendEmpty()
+							sm.Scope().CopyTo(rollup.target.Scope())
+						}
+						rollups[resourceKey] = rollup
+						rollupOrder = append(rollupOrder, rollup)
+					}
+					return rollup
+				}
+
 				// Process and filter datapoints
 				processDataPoints := func(originalDps pmetric.NumberDataPointSlice) {
 					for l := 0; l < originalDps.Len(); l++ {
 						dp := originalDps.At(l)
-						if shouldRollupDP(dp.Attributes()) {
+						attrs := metricsutil.Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()}
+						if shouldRollupDP(attrs) {
 							metricName := metric.Name()
-							aggState, exists := rollupData[resourceKey][metricName]
-							if !exists {
+							rollup := rollupFor()
+							rolled, ok := rollup.metrics[metricName]
+							if !ok {
+								rolled = &rolledUpMetric{metadata: metric, groups: make(map[string]*AggregationState)}
+								rollup.metrics[metricName] = rolled
+								rollup.order = append(rollup.order, metricName)
+							}
+							groupKey, groupValues := p.groupOf(attrs)
+							aggState := rolled.other
+							if groupValues != nil {
+								aggState = rolled.groups[groupKey]
+							}
+							if aggState == nil {
 								aggType := SumAggregation // Default aggregation type
 								if configuredType, ok := p.config.Aggregations[metricName]; ok {
-									aggType = configuredType
+									aggType = configuredType.normalize()
 								} else if metric.Type() == pmetric.MetricTypeGauge { // Default for Gauge if not specified
 									aggType = AvgAggregation
 								}
-								aggState = &AggregationState{Type: aggType}
-								rollupData[resourceKey][metricName] = aggState
+								aggState = &AggregationState{Metric: metricName, Group: groupValues, Type: aggType}
+								for _, additional := range p.config.AdditionalAggregations[metricName] {
+									aggState.Additional = append(aggState.Additional, additional.normalize())
+								}
+								aggState.KeepValues = p.config.EmitDistribution || aggState.needsValues()
+								if groupValues != nil {
+									rolled.groups[groupKey] = aggState
+								} else {
+									rolled.other = aggState
+								}
 							}
 
-							val := getNumericValue(dp)
-							aggState.Sum += val
-							aggState.Count++
+							aggState.add(getNumericValue(dp), dp.Timestamp())
 
-							if pidVal, pidExists := dp.Attributes().Get(processPIDKey); pidExists {
-								if _, ok := rolledUpPIDsPerMetric[resourceKey][metricName]; !ok {
-									rolledUpPIDsPerMetric[resourceKey][metricName] = make(map[string]bool)
+							if identity, identified := identities.Get(attrs); identified {
+								if _, ok := rollup.processes[metricName]; !ok {
+									rollup.processes[metricName] = make(map[string]string)
 								}
-								rolledUpPIDsPerMetric[resourceKey][metricName][pidVal.Str()] = true
+								pidVal, _ := attrs.Get(processPIDKey)
+								rollup.processes[metricName][identity] = pidVal.AsString()
 							}
 						} else {
 							dp.CopyTo(passThroughDps.AppendEmpty()) // Add to pass-through slice
@@ -183,74 +339,52 @@ func (p *othersRollupProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 					}
 				}
 			} // End iterating original metrics (k loop)
+		} // End iterating scope metrics (j loop)
+	} // End iterating resource metrics (i loop)
 
-			// Now, add the new rolled-up metrics to newSm for this resourceKey
-			if resRollupData, ok := rollupData[resourceKey]; ok {
-				aggregatedSeriesGenerated := int64(0)
-				totalInputSeriesRolledUp := int64(0)
-
-				for metricName, aggState := range resRollupData {
-					if aggState.Count == 0 {
-						continue
-					}
-					aggregatedSeriesGenerated++
-					if pidsMap, found := rolledUpPIDsPerMetric[resourceKey][metricName]; found {
-						totalInputSeriesRolledUp += int64(len(pidsMap))
-					}
-
-					rolledUpMetric := newSm.Metrics().AppendEmpty()
-					rolledUpMetric.SetName(metricName)
-					// Find original metric to copy metadata (Unit, Description, etc.)
-					var originalMetricMetadata pmetric.Metric
-					for k := 0; k < sm.Metrics().Len(); k++ {
-						if sm.Metrics().At(k).Name() == metricName {
-							originalMetricMetadata = sm.Metrics().At(k)
-							break
-						}
-					}
-					// Set metadata from original metric
-					rolledUpMetric.SetDescription(originalMetricMetadata.Description())
-					rolledUpMetric.SetUnit(originalMetricMetadata.Unit())
-
-					newDp := rolledUpMetric.SetEmptyGauge().DataPoints().AppendEmpty() // Default to Gauge for rolled-up
-					// If original was Sum and aggregation is Sum, new should be Sum
-					// Check if the original metric was a Sum and we're using sum aggregation
-					if originalMetricMetadata.Type() == pmetric.MetricTypeSum && aggState.Type == SumAggregation {
-						rolledUpMetric.SetEmptySum().SetIsMonotonic(originalMetricMetadata.Sum().IsMonotonic())
-						rolledUpMetric.Sum().SetAggregationTemporality(originalMetricMetadata.Sum().AggregationTemporality())
-						newDp = rolledUpMetric.Sum().DataPoints().AppendEmpty()
-					} else {
-						// For Avg or if original was Gauge, new is Gauge
-						rolledUpMetric.SetEmptyGauge()
-						newDp = rolledUpMetric.Gauge().DataPoints().AppendEmpty()
-					}
-
-					if aggState.Type == AvgAggregation && aggState.Count > 0 {
-						newDp.SetDoubleValue(aggState.Sum / float64(aggState.Count))
-					} else { // Default to Sum
-						newDp.SetDoubleValue(aggState.Sum)
-					}
-					newDp.SetTimestamp(pcommon.NewTimestampFromTime(time.Now())) // Or use latest timestamp from rolled DPs
-					newDp.Attributes().PutStr(processPIDKey, p.config.OutputPIDAttributeValue)
-					newDp.Attributes().PutStr(processExecutableNameKey, p.config.OutputExecutableNameAttributeValue)
-					// Copy other non-process specific attributes from resource if needed
-				}
-				p.obsrep.recordAggregatedSeries(ctx, aggregatedSeriesGenerated)
-				p.obsrep.recordInputSeriesRolledUp(ctx, totalInputSeriesRolledUp)
+	// Now, add the new rolled-up metrics of each resource
+	aggregatedSeriesGenerated := int64(0)
+	totalInputSeriesRolledUp := int64(0)
+	groupOverflow := int64(0)
+	for _, rollup := range rollupOrder {
+		for _, pidsMap := range rollup.processes {
+			totalInputSeriesRolledUp += int64(len(pidsMap))
+		}
+		for _, metricName := range rollup.order {
+			rolled := rollup.metrics[metricName]
+			series, overflow := rolled.series(p.config.maxGroups())
+			groupOverflow += overflow
+			// All series of a metric share its aggregation types
+			first := series[0]
+			p.appendRollup(rollup.target, metricName, first.Type, series, rolled.metadata)
+			aggregatedSeriesGenerated += int64(len(series))
+			for _, additional := range first.Additional {
+				p.appendRollup(rollup.target, metricName+"."+string(additional), additional, series, rolled.metadata)
+				aggregatedSeriesGenerated += int64(len(series))
 			}
-			// If newSm has no metrics after filtering and rollup, it will be removed by the later check
-			if newSm.Metrics().Len() == 0 {
-				newRm.ScopeMetrics().RemoveIf(func(s pmetric.ScopeMetrics) bool {
-					return s.Metrics().Len() == 0 // A simple check for empty scope
-				})
+			if p.config.EmitDistribution {
+				p.appendDistribution(rollup.target, metricName, series, rolled.metadata)
+				aggregatedSeriesGenerated += int64(len(series))
 			}
-		} // End iterating scope metrics (j loop)
-		if newRm.ScopeMetrics().Len() == 0 {
-			newMetrics.ResourceMetrics().RemoveIf(func(r pmetric.ResourceMetrics) bool {
-				return r.ScopeMetrics().Len() == 0 // Remove empty resource metrics
-			})
 		}
-	} // End iterating resource metrics (i loop)
+	}
+	if len(rollupOrder) > 0 {
+		p.obsrep.recordAggregatedSeries(ctx, aggregatedSeriesGenerated)
+		p.obsrep.recordInputSeriesRolledUp(ctx, totalInputSeriesRolledUp)
+	}
+	p.obsrep.recordGroupOverflow(ctx, groupOverflow)
+
+	// Remove the scopes and resources left empty by the rollup
+	newMetrics.ResourceMetrics().RemoveIf(func(r pmetric.ResourceMetrics) bool {
+		r.ScopeMetrics().RemoveIf(func(s pmetric.ScopeMetrics) bool {
+			return s.Metrics().Len() == 0
+		})
+		return r.ScopeMetrics().Len() == 0
+	})
+
+	if p.recorder != nil {
+		p.recordDecisions(rollupOrder)
+	}
 
 	finalMetricPointCount := metricsutil.CountPoints(newMetrics)
 	droppedCount := originalMetricPointCount - finalMetricPointCount
@@ -264,6 +398,70 @@ func (p *othersRollupProcessor) ConsumeMetrics(ctx context.Context, md pmetric.M
 	return p.nextConsumer.ConsumeMetrics(ctx, newMetrics)
 }
 
+// appendRollup adds the rolled-up series of one aggregation of a metric to sm, one data point
+// per series.
+func (p *othersRollupProcessor) appendRollup(sm pmetric.ScopeMetrics, name string, agg AggregationType, series []*AggregationState, originalMetricMetadata pmetric.Metric) {
+	rolledUpMetric := sm.Metrics().AppendEmpty()
+	rolledUpMetric.SetName(name)
+	// Set metadata from original metric
+	rolledUpMetric.SetDescription(originalMetricMetadata.Description())
+	if agg == CountAggregation {
+		rolledUpMetric.SetUnit("{data_points}")
+	} else {
+		rolledUpMetric.SetUnit(originalMetricMetadata.Unit())
+	}
+
+	var dps pmetric.NumberDataPointSlice
+	// If original was Sum and aggregation is Sum, new should be Sum
+	if originalMetricMetadata.Type() == pmetric.MetricTypeSum && agg == SumAggregation {
+		rolledUpMetric.SetEmptySum().SetIsMonotonic(originalMetricMetadata.Sum().IsMonotonic())
+		rolledUpMetric.Sum().SetAggregationTemporality(originalMetricMetadata.Sum().AggregationTemporality())
+		dps = rolledUpMetric.Sum().DataPoints()
+	} else {
+		// Every other aggregation, or an original Gauge, is a Gauge
+		dps = rolledUpMetric.SetEmptyGauge().DataPoints()
+	}
+
+	now := pcommon.NewTimestampFromTime(time.Now()) // Or use latest timestamp from rolled DPs
+	for _, aggState := range series {
+		newDp := dps.AppendEmpty()
+		if agg == CountAggregation {
+			newDp.SetIntValue(aggState.Count)
+		} else {
+			newDp.SetDoubleValue(aggState.value(agg))
+		}
+		newDp.SetTimestamp(now)
+		newDp.Attributes().PutStr(processPIDKey, p.config.OutputPIDAttributeValue)
+		newDp.Attributes().PutStr(processExecutableNameKey, p.config.OutputExecutableNameAttributeValue)
+		p.putGroup(newDp.Attributes(), aggState)
+		// Copy other non-process specific attributes from resource if needed
+	}
+}
+
+// recordDecisions reports to the explain extension which metrics of each process were rolled up.
+func (p *othersRollupProcessor) recordDecisions(rollups []*rollupResource) {
+	metricsPerProcess := make(map[string][]string) // Process identity -> metric names
+	pids := make(map[string]string)                // Process identity -> PID
+	for _, rollup := range rollups {
+		for metricName, processes := range rollup.processes {
+			for identity, pid := range processes {
+				metricsPerProcess[identity] = append(metricsPerProcess[identity], metricName)
+				pids[identity] = pid
+			}
+		}
+	}
+	batch := make([]decisions.Decision, 0, len(metricsPerProcess))
+	for identity, metricNames := range metricsPerProcess {
+		sort.Strings(metricNames)
+		batch = append(batch, decisions.Decision{
+			PID:     pids[identity],
+			Outcome: decisions.OutcomeRolledUp,
+			Detail:  "rolled up " + strings.Join(metricNames, ", "),
+		})
+	}
+	p.recorder.RecordDecisions(p.id, batch)
+}
+
 func getNumericValue(dp pmetric.NumberDataPoint) float64 {
 	switch dp.ValueType() {
 	case pmetric.NumberDataPointValueTypeInt:
@@ -274,6 +472,17 @@ func getNumericValue(dp pmetric.NumberDataPoint) float64 {
 	return 0
 }
 
+// rollupResourceAttributes returns the resource attributes without the process.* attributes,
+// which identify a single process and do not apply to the rolled-up series.
+func rollupResourceAttributes(attrs pcommon.Map) pcommon.Map {
+	rollupAttrs := pcommon.NewMap()
+	attrs.CopyTo(rollupAttrs)
+	rollupAttrs.RemoveIf(func(k string, _ pcommon.Value) bool {
+		return strings.HasPrefix(k, "process.")
+	})
+	return rollupAttrs
+}
+
 // resourceAttributesToString converts resource attributes to a string for use as a map key
 func resourceAttributesToString(attrs pcommon.Map) string {
 	if attrs.Len() == 0 {
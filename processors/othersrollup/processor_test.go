@@ -2,13 +2,17 @@ package othersrollup
 
 import (
 	"context"
+	"math"
+	"strconv"
 	"testing"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/processor"
 )
@@ -182,3 +186,414 @@ func TestOthersRollup_Average(t *testing.T) {
 	assert.True(t, foundRolledUpAvg, "Rolled up average not found")
 	assert.True(t, foundCriticalPassThrough, "Critical pass-through not found")
 }
+
+func TestOthersRollup_AdditionalAggregations(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "_other_pid_",
+		OutputExecutableNameAttributeValue: "_other_exe_",
+		Aggregations: map[string]AggregationType{
+			"process.cpu.utilization": "AVG", // Validate accepts any case
+		},
+		AdditionalAggregations: map[string][]AggregationType{
+			"process.cpu.utilization": {MaxAggregation, MinAggregation, CountAggregation, LastAggregation, P50Aggregation, P95Aggregation},
+		},
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+	}
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	settings := processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	proc, err := newOthersRollupProcessor(settings, nextSink, cfg)
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	cpuMetric := sm.Metrics().AppendEmpty()
+	cpuMetric.SetName("process.cpu.utilization")
+	cpuMetric.SetUnit("1")
+	cpuMetric.SetEmptyGauge()
+	// One hot process among idle ones; the average hides it
+	for i, v := range []float64{0.01, 0.95, 0.02, 0.03} {
+		dp := cpuMetric.Gauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(v)
+		dp.SetTimestamp(pcommon.Timestamp(100 - i)) // The first data point is the latest
+		dp.Attributes().PutStr(processPIDKey, strconv.Itoa(30+i))
+	}
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	require.Len(t, nextSink.AllMetrics(), 1)
+	outputSm := nextSink.AllMetrics()[0].ResourceMetrics().At(0).ScopeMetrics().At(0)
+	require.Equal(t, 7, outputSm.Metrics().Len(), "the primary aggregation and six additional ones")
+
+	values := map[string]float64{}
+	for i := 0; i < outputSm.Metrics().Len(); i++ {
+		m := outputSm.Metrics().At(i)
+		require.Equal(t, pmetric.MetricTypeGauge, m.Type(), m.Name())
+		dp := m.Gauge().DataPoints().At(0)
+		pid, _ := dp.Attributes().Get(processPIDKey)
+		assert.Equal(t, cfg.OutputPIDAttributeValue, pid.Str(), m.Name())
+		if m.Name() == "process.cpu.utilization.count" {
+			assert.Equal(t, "{data_points}", m.Unit())
+			values[m.Name()] = float64(dp.IntValue())
+			continue
+		}
+		assert.Equal(t, "1", m.Unit(), m.Name())
+		values[m.Name()] = dp.DoubleValue()
+	}
+	assert.InDelta(t, 0.2525, values["process.cpu.utilization"], 1e-9)
+	assert.Equal(t, 0.95, values["process.cpu.utilization.max"])
+	assert.Equal(t, 0.01, values["process.cpu.utilization.min"])
+	assert.Equal(t, 4.0, values["process.cpu.utilization.count"])
+	assert.Equal(t, 0.01, values["process.cpu.utilization.last"])
+	assert.Equal(t, 0.02, values["process.cpu.utilization.p50"])
+	assert.Equal(t, 0.95, values["process.cpu.utilization.p95"])
+}
+
+func TestOthersRollup_SkipsTopKSelected(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "-1",
+		OutputExecutableNameAttributeValue: "_other_",
+		Aggregations: map[string]AggregationType{
+			"process.cpu.utilization": SumAggregation,
+		},
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+		TopKAttributeName:      "nr.topk.selected",
+	}
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	settings := processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	proc, err := newOthersRollupProcessor(settings, nextSink, cfg)
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	cpuMetric := sm.Metrics().AppendEmpty()
+	cpuMetric.SetName("process.cpu.utilization")
+	dps := cpuMetric.SetEmptyGauge().DataPoints()
+
+	dp := dps.AppendEmpty()
+	dp.SetDoubleValue(0.7)
+	dp.Attributes().PutStr(processPIDKey, "30")
+	dp.Attributes().PutBool("nr.topk.selected", true)
+
+	dp = dps.AppendEmpty()
+	dp.SetDoubleValue(0.25)
+	dp.Attributes().PutStr(processPIDKey, "31")
+	dp.Attributes().PutBool("nr.topk.selected", false)
+
+	dp = dps.AppendEmpty()
+	dp.SetDoubleValue(0.5)
+	dp.Attributes().PutStr(processPIDKey, "32")
+	dp.Attributes().PutBool("nr.topk.selected", false)
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	require.Len(t, nextSink.AllMetrics(), 1)
+
+	values := make(map[string]float64)
+	outputMetrics := nextSink.AllMetrics()[0].ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics()
+	for i := 0; i < outputMetrics.Len(); i++ {
+		outDps := outputMetrics.At(i).Gauge().DataPoints()
+		for j := 0; j < outDps.Len(); j++ {
+			pid, _ := outDps.At(j).Attributes().Get(processPIDKey)
+			values[pid.Str()] = outDps.At(j).DoubleValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{"30": 0.7, "-1": 0.75}, values)
+}
+
+type recorderFunc func(processor component.ID, batch []decisions.Decision)
+
+func (f recorderFunc) RecordDecisions(processor component.ID, batch []decisions.Decision) {
+	f(processor, batch)
+}
+
+func TestOthersRollup_HostmetricsResourceAttributes(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	proc, err := newOthersRollupProcessor(processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+	}, nextSink, cfg)
+	require.NoError(t, err)
+	var rolledUp []string
+	proc.recorder = recorderFunc(func(_ component.ID, batch []decisions.Decision) {
+		for _, d := range batch {
+			rolledUp = append(rolledUp, d.PID)
+		}
+	})
+
+	// Shaped like the hostmetrics process scraper's output: process attributes on the
+	// resource, with prioritytagger's tag on the data points of the critical process
+	md := pmetric.NewMetrics()
+	for _, pid := range []int64{1, 2, 3} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutStr("host.name", "host-1")
+		rm.Resource().Attributes().PutInt(processPIDKey, pid)
+		rm.Resource().Attributes().PutStr(processExecutableNameKey, "proc")
+		cpu := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		cpu.SetName("process.cpu.utilization")
+		dp := cpu.SetEmptyGauge().DataPoints().AppendEmpty()
+		dp.Attributes().PutStr("state", "user")
+		dp.SetDoubleValue(0.1 * float64(pid))
+		if pid == 1 {
+			dp.Attributes().PutStr(cfg.PriorityAttributeName, cfg.CriticalAttributeValue)
+		}
+	}
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	assert.ElementsMatch(t, []string{"2", "3"}, rolledUp, "Only PIDs 2 and 3, read from their resources, should be rolled up")
+
+	out := nextSink.AllMetrics()[0].ResourceMetrics()
+	require.Equal(t, 2, out.Len(), "the critical process and a single _other_ resource")
+	critical := out.At(0).ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints().At(0)
+	_, rewritten := critical.Attributes().Get(processPIDKey)
+	assert.False(t, rewritten, "The critical process should pass through untouched")
+
+	// Both processes roll up into one series, on a resource without their process attributes
+	otherRm := out.At(1)
+	assert.Equal(t, map[string]any{"host.name": "host-1"}, otherRm.Resource().Attributes().AsRaw())
+	require.Equal(t, 1, otherRm.ScopeMetrics().At(0).Metrics().Len())
+	others := otherRm.ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints()
+	require.Equal(t, 1, others.Len())
+	pid, _ := others.At(0).Attributes().Get(processPIDKey)
+	assert.Equal(t, cfg.OutputPIDAttributeValue, pid.Str())
+	assert.InDelta(t, 0.25, others.At(0).DoubleValue(), 1e-9, "average of 0.2 and 0.3")
+}
+
+func TestOthersRollup_Distribution(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "_other_pid_",
+		OutputExecutableNameAttributeValue: "_other_exe_",
+		PriorityAttributeName:              "nr.priority",
+		CriticalAttributeValue:             "critical",
+		EmitDistribution:                   true,
+		DistributionMaxSize:                20,
+	}
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	settings := processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	proc, err := newOthersRollupProcessor(settings, nextSink, cfg)
+	require.NoError(t, err)
+
+	md := pmetric.NewMetrics()
+	sm := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty()
+	cpuMetric := sm.Metrics().AppendEmpty()
+	cpuMetric.SetName("process.cpu.utilization")
+	cpuMetric.SetUnit("1")
+	cpuMetric.SetEmptyGauge()
+	// 30 idle processes and 2 busy ones
+	values := []float64{0.4, 0.41}
+	for i := 0; i < 30; i++ {
+		values = append(values, 0)
+	}
+	for i, v := range values {
+		dp := cpuMetric.Gauge().DataPoints().AppendEmpty()
+		dp.SetDoubleValue(v)
+		dp.Attributes().PutStr(processPIDKey, strconv.Itoa(100+i))
+	}
+
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+	outputSm := nextSink.AllMetrics()[0].ResourceMetrics().At(0).ScopeMetrics().At(0)
+	require.Equal(t, 2, outputSm.Metrics().Len(), "the average and its distribution")
+
+	var distribution pmetric.Metric
+	for i := 0; i < outputSm.Metrics().Len(); i++ {
+		if m := outputSm.Metrics().At(i); m.Name() == "process.cpu.utilization"+distributionSuffix {
+			distribution = m
+		}
+	}
+	require.Equal(t, pmetric.MetricTypeExponentialHistogram, distribution.Type())
+	assert.Equal(t, "1", distribution.Unit())
+	dp := distribution.ExponentialHistogram().DataPoints().At(0)
+	pid, _ := dp.Attributes().Get(processPIDKey)
+	assert.Equal(t, cfg.OutputPIDAttributeValue, pid.Str())
+	assert.Equal(t, uint64(32), dp.Count())
+	assert.Equal(t, uint64(30), dp.ZeroCount())
+	assert.InDelta(t, 0.81, dp.Sum(), 1e-9)
+	assert.Equal(t, 0.41, dp.Max())
+
+	// Both busy processes are in buckets no wider than the bounded relative error allows
+	buckets := dp.Positive().BucketCounts().AsRaw()
+	assert.LessOrEqual(t, len(buckets), cfg.DistributionMaxSize)
+	var counted uint64
+	base := math.Pow(2, math.Pow(2, -float64(dp.Scale())))
+	for i, c := range buckets {
+		if c == 0 {
+			continue
+		}
+		counted += c
+		lower := math.Pow(base, float64(dp.Positive().Offset()+int32(i)))
+		assert.True(t, lower < 0.41 && lower*base >= 0.4, "bucket %d (%g, %g] holds a busy process", i, lower, lower*base)
+	}
+	assert.Equal(t, uint64(2), counted)
+	assert.Less(t, base-1, 0.1, "relative error stays under 10%")
+}
+
+func TestOthersRollup_DistributionNonFiniteValues(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "_other_pid_",
+		OutputExecutableNameAttributeValue: "_other_exe_",
+		PriorityAttributeName:              "nr.priority",
+		CriticalAttributeValue:             "critical",
+		EmitDistribution:                   true,
+	}
+	require.NoError(t, cfg.Validate())
+
+	for _, tc := range []struct {
+		name      string
+		values    []float64
+		wantCount uint64
+	}{
+		{"NaN", []float64{1, math.NaN()}, 1},
+		{"positive infinity", []float64{1, math.Inf(1)}, 1},
+		{"negative infinity", []float64{math.Inf(-1), 2, -3}, 2},
+		{"only non-finite", []float64{math.NaN(), math.Inf(1)}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nextSink := new(consumertest.MetricsSink)
+			settings := processor.CreateSettings{
+				ID:                component.NewID(typeStr),
+				TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+				BuildInfo:         component.NewDefaultBuildInfo(),
+			}
+			proc, err := newOthersRollupProcessor(settings, nextSink, cfg)
+			require.NoError(t, err)
+
+			md := pmetric.NewMetrics()
+			gauge := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			gauge.SetName("process.cpu.utilization")
+			gauge.SetEmptyGauge()
+			for i, v := range tc.values {
+				dp := gauge.Gauge().DataPoints().AppendEmpty()
+				dp.SetDoubleValue(v)
+				dp.Attributes().PutStr(processPIDKey, strconv.Itoa(i+1))
+			}
+
+			require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+			outputSm := nextSink.AllMetrics()[0].ResourceMetrics().At(0).ScopeMetrics().At(0)
+			var dp pmetric.ExponentialHistogramDataPoint
+			for i := 0; i < outputSm.Metrics().Len(); i++ {
+				if m := outputSm.Metrics().At(i); m.Type() == pmetric.MetricTypeExponentialHistogram {
+					dp = m.ExponentialHistogram().DataPoints().At(0)
+				}
+			}
+			assert.Equal(t, tc.wantCount, dp.Count())
+			var bucketed uint64
+			for _, c := range dp.Positive().BucketCounts().AsRaw() {
+				bucketed += c
+			}
+			for _, c := range dp.Negative().BucketCounts().AsRaw() {
+				bucketed += c
+			}
+			assert.Equal(t, tc.wantCount, bucketed+dp.ZeroCount(), "every finite value is in a bucket")
+			assert.False(t, math.IsNaN(dp.Sum()) || math.IsInf(dp.Sum(), 0), "sum of finite values only")
+		})
+	}
+}
+
+func TestDistributionScale(t *testing.T) {
+	// Finest scale when one bucket suffices
+	assert.Equal(t, maxDistributionScale, distributionScale(1, 1, 160))
+	// Six orders of magnitude in 160 buckets need scale 3 (8 buckets per power of 2)
+	scale := distributionScale(1e-3, 1e3, 160)
+	assert.Equal(t, int32(3), scale)
+	assert.Less(t, int(bucketIndex(1e3, scale)-bucketIndex(1e-3, scale)), 160)
+	// Powers of the base are upper bucket bounds
+	assert.Equal(t, int32(-1), bucketIndex(1, 0))
+	assert.Equal(t, int32(0), bucketIndex(2, 0))
+	assert.Equal(t, int32(1), bucketIndex(3, 0))
+}
+
+func TestOthersRollup_GroupBy(t *testing.T) {
+	cfg := &Config{
+		OutputPIDAttributeValue:            "-1",
+		OutputExecutableNameAttributeValue: "_other_",
+		Aggregations: map[string]AggregationType{
+			"process.memory.rss": SumAggregation,
+		},
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+		GroupBy:                []string{processExecutableNameKey},
+		MaxGroups:              2,
+	}
+	require.NoError(t, cfg.Validate())
+
+	nextSink := new(consumertest.MetricsSink)
+	settings := processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+	proc, err := newOthersRollupProcessor(settings, nextSink, cfg)
+	require.NoError(t, err)
+
+	type process struct {
+		exe   string
+		value int64
+	}
+	processes := []process{
+		{"redis", 70}, // Smallest group, over max_groups although it comes first
+		{"nginx", 100}, {"postgres", 500}, {"nginx", 150},
+		{"", 30}, // No executable name
+	}
+	// One resource per process, as from the hostmetrics process scraper
+	batch := func(processes []process) pmetric.Metrics {
+		md := pmetric.NewMetrics()
+		for i, p := range processes {
+			rm := md.ResourceMetrics().AppendEmpty()
+			rm.Resource().Attributes().PutStr("host.name", "host-1")
+			rm.Resource().Attributes().PutStr(processPIDKey, strconv.Itoa(10+i))
+			if p.exe != "" {
+				rm.Resource().Attributes().PutStr(processExecutableNameKey, p.exe)
+			}
+			memMetric := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+			memMetric.SetName("process.memory.rss")
+			memMetric.SetEmptyGauge().DataPoints().AppendEmpty().SetIntValue(p.value)
+		}
+		return md
+	}
+	reversed := make([]process, len(processes))
+	for i, p := range processes {
+		reversed[len(processes)-1-i] = p
+	}
+
+	for _, md := range []pmetric.Metrics{batch(processes), batch(reversed)} {
+		nextSink.Reset()
+		require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+		out := nextSink.AllMetrics()[0].ResourceMetrics()
+		require.Equal(t, 1, out.Len(), "all processes of the host roll up together")
+		outputSm := out.At(0).ScopeMetrics().At(0)
+		require.Equal(t, 1, outputSm.Metrics().Len(), "one metric with a data point per group")
+		m := outputSm.Metrics().At(0)
+		require.Equal(t, "process.memory.rss", m.Name())
+
+		sums := map[string]float64{}
+		for i := 0; i < m.Gauge().DataPoints().Len(); i++ {
+			dp := m.Gauge().DataPoints().At(i)
+			pid, _ := dp.Attributes().Get(processPIDKey)
+			assert.Equal(t, "-1", pid.Str())
+			exe, _ := dp.Attributes().Get(processExecutableNameKey)
+			sums[exe.Str()] = dp.DoubleValue()
+		}
+		// The largest groups are named whatever the order of the processes
+		assert.Equal(t, map[string]float64{"nginx": 250, "postgres": 500, "_other_": 100}, sums)
+	}
+}
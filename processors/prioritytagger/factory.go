@@ -55,5 +55,6 @@ func createMetricsProcessor(
 	if err != nil {
 		return nil, err
 	}
+	proc.id = set.ID
 	return proc, nil
 }
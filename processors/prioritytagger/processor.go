@@ -3,6 +3,8 @@ package prioritytagger
 import (
 	"context"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
+	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/pdata/pcommon"
@@ -12,16 +14,18 @@ import (
 
 const (
 	// Process metric attribute names
-	processExecutableNameKey = "process.executable.name"
+	processExecutableNameKey = metricsutil.ProcessExecutableNameKey
 	processCPUUtilizationKey = "process.cpu.utilization"
 	processMemoryRSSKey      = "process.memory.rss"
 )
 
 type priorityTaggerProcessor struct {
+	id              component.ID
 	config          *Config
 	logger          *zap.Logger
 	metricsConsumer consumer.Metrics
 	obsrecv         *obsreportHelper
+	recorder        decisions.Recorder // Set in Start when an explain extension is configured
 }
 
 func newProcessor(config *Config, logger *zap.Logger, mexp consumer.Metrics, settings component.TelemetrySettings) (*priorityTaggerProcessor, error) {
@@ -38,7 +42,8 @@ func newProcessor(config *Config, logger *zap.Logger, mexp consumer.Metrics, set
 	}, nil
 }
 
-func (p *priorityTaggerProcessor) Start(_ context.Context, _ component.Host) error {
+func (p *priorityTaggerProcessor) Start(_ context.Context, host component.Host) error {
+	p.recorder = decisions.FindRecorder(host)
 	return nil
 }
 
@@ -69,8 +74,11 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 	processedCount := 0
 
 	// Track which process IDs have been tagged as critical
-	// to avoid counting the same process multiple times in our custom metric
-	taggedProcesses := make(map[string]bool)
+	// to avoid counting the same process multiple times in our custom metric.
+	// Maps each process ID to the PID or executable name it is reported by.
+	taggedProcesses := make(map[string]string)
+	// Resolved once per PID, so every data point of a process has the same identity
+	identities := metricsutil.ResolveProcessIdentities(md)
 
 	// Iterate through the resource metrics
 	for i := 0; i < md.ResourceMetrics().Len(); i++ {
@@ -89,13 +97,14 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 				case pmetric.MetricTypeGauge:
 					pts := metric.Gauge().DataPoints()
 					for l := 0; l < pts.Len(); l++ {
-						if isCriticalProcess(pts.At(l).Attributes(), p.config) {
-							markAsCritical(pts.At(l).Attributes(), p.config)
+						attrs := metricsutil.Attributes{Point: pts.At(l).Attributes(), Resource: rm.Resource().Attributes()}
+						if isCriticalProcess(attrs, p.config) {
+							markAsCritical(attrs.Point, p.config)
 
 							// Record the process as tagged for the custom metric
-							processID := getProcessID(pts.At(l).Attributes())
-							if processID != "" && !taggedProcesses[processID] {
-								taggedProcesses[processID] = true
+							processID, name := getProcessID(identities, attrs)
+							if _, tagged := taggedProcesses[processID]; processID != "" && !tagged {
+								taggedProcesses[processID] = name
 								p.obsrecv.RecordTaggedProcess(ctx)
 							}
 						}
@@ -104,13 +113,14 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 				case pmetric.MetricTypeSum:
 					pts := metric.Sum().DataPoints()
 					for l := 0; l < pts.Len(); l++ {
-						if isCriticalProcess(pts.At(l).Attributes(), p.config) {
-							markAsCritical(pts.At(l).Attributes(), p.config)
+						attrs := metricsutil.Attributes{Point: pts.At(l).Attributes(), Resource: rm.Resource().Attributes()}
+						if isCriticalProcess(attrs, p.config) {
+							markAsCritical(attrs.Point, p.config)
 
 							// Record the process as tagged for the custom metric
-							processID := getProcessID(pts.At(l).Attributes())
-							if processID != "" && !taggedProcesses[processID] {
-								taggedProcesses[processID] = true
+							processID, name := getProcessID(identities, attrs)
+							if _, tagged := taggedProcesses[processID]; processID != "" && !tagged {
+								taggedProcesses[processID] = name
 								p.obsrecv.RecordTaggedProcess(ctx)
 							}
 						}
@@ -119,13 +129,14 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 				case pmetric.MetricTypeHistogram:
 					pts := metric.Histogram().DataPoints()
 					for l := 0; l < pts.Len(); l++ {
-						if isCriticalProcess(pts.At(l).Attributes(), p.config) {
-							markAsCritical(pts.At(l).Attributes(), p.config)
+						attrs := metricsutil.Attributes{Point: pts.At(l).Attributes(), Resource: rm.Resource().Attributes()}
+						if isCriticalProcess(attrs, p.config) {
+							markAsCritical(attrs.Point, p.config)
 
 							// Record the process as tagged for the custom metric
-							processID := getProcessID(pts.At(l).Attributes())
-							if processID != "" && !taggedProcesses[processID] {
-								taggedProcesses[processID] = true
+							processID, name := getProcessID(identities, attrs)
+							if _, tagged := taggedProcesses[processID]; processID != "" && !tagged {
+								taggedProcesses[processID] = name
 								p.obsrecv.RecordTaggedProcess(ctx)
 							}
 						}
@@ -134,13 +145,14 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 				case pmetric.MetricTypeSummary:
 					pts := metric.Summary().DataPoints()
 					for l := 0; l < pts.Len(); l++ {
-						if isCriticalProcess(pts.At(l).Attributes(), p.config) {
-							markAsCritical(pts.At(l).Attributes(), p.config)
+						attrs := metricsutil.Attributes{Point: pts.At(l).Attributes(), Resource: rm.Resource().Attributes()}
+						if isCriticalProcess(attrs, p.config) {
+							markAsCritical(attrs.Point, p.config)
 
 							// Record the process as tagged for the custom metric
-							processID := getProcessID(pts.At(l).Attributes())
-							if processID != "" && !taggedProcesses[processID] {
-								taggedProcesses[processID] = true
+							processID, name := getProcessID(identities, attrs)
+							if _, tagged := taggedProcesses[processID]; processID != "" && !tagged {
+								taggedProcesses[processID] = name
 								p.obsrecv.RecordTaggedProcess(ctx)
 							}
 						}
@@ -149,13 +161,14 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 				case pmetric.MetricTypeExponentialHistogram:
 					pts := metric.ExponentialHistogram().DataPoints()
 					for l := 0; l < pts.Len(); l++ {
-						if isCriticalProcess(pts.At(l).Attributes(), p.config) {
-							markAsCritical(pts.At(l).Attributes(), p.config)
+						attrs := metricsutil.Attributes{Point: pts.At(l).Attributes(), Resource: rm.Resource().Attributes()}
+						if isCriticalProcess(attrs, p.config) {
+							markAsCritical(attrs.Point, p.config)
 
 							// Record the process as tagged for the custom metric
-							processID := getProcessID(pts.At(l).Attributes())
-							if processID != "" && !taggedProcesses[processID] {
-								taggedProcesses[processID] = true
+							processID, name := getProcessID(identities, attrs)
+							if _, tagged := taggedProcesses[processID]; processID != "" && !tagged {
+								taggedProcesses[processID] = name
 								p.obsrecv.RecordTaggedProcess(ctx)
 							}
 						}
@@ -166,6 +179,14 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 		}
 	}
 
+	if p.recorder != nil && len(taggedProcesses) > 0 {
+		batch := make([]decisions.Decision, 0, len(taggedProcesses))
+		for _, name := range taggedProcesses {
+			batch = append(batch, decisions.Decision{PID: name, Outcome: decisions.OutcomeCritical})
+		}
+		p.recorder.RecordDecisions(p.id, batch)
+	}
+
 	p.logger.Debug("PriorityTagger processor processed metrics",
 		zap.Int("processed_count", processedCount),
 		zap.Int("tagged_processes", len(taggedProcesses)))
@@ -174,7 +195,7 @@ func (p *priorityTaggerProcessor) processMetrics(ctx context.Context, md pmetric
 }
 
 // isCriticalProcess determines if a process is critical based on configuration criteria
-func isCriticalProcess(attrs pcommon.Map, cfg *Config) bool {
+func isCriticalProcess(attrs metricsutil.Attributes, cfg *Config) bool {
 	// Check if it's already tagged as critical
 	if value, exists := attrs.Get(cfg.PriorityAttributeName); exists {
 		if value.Str() == cfg.CriticalAttributeValue {
@@ -236,23 +257,25 @@ func isCriticalProcess(attrs pcommon.Map, cfg *Config) bool {
 	return false
 }
 
-// markAsCritical adds the priority tag to the process attributes
+// markAsCritical adds the priority tag to the data point attributes, where the other processors
+// look for it first, even when the process attributes are on the resource
 func markAsCritical(attrs pcommon.Map, cfg *Config) {
 	attrs.PutStr(cfg.PriorityAttributeName, cfg.CriticalAttributeValue)
 }
 
-// getProcessID extracts a unique process identifier from attributes
-// This is used to count unique tagged processes for the custom metric
-func getProcessID(attrs pcommon.Map) string {
-	// Try to get process.pid first
-	if pid, exists := attrs.Get("process.pid"); exists {
-		return pid.Str()
+// getProcessID extracts a unique process identifier from attributes, and the PID or executable
+// name to report it by. This is used to count unique tagged processes for the custom metric
+func getProcessID(identities metricsutil.ProcessIdentities, attrs metricsutil.Attributes) (id string, name string) {
+	// Try the process identity first, so a reused PID counts as a new process
+	if identity, ok := identities.Get(attrs); ok {
+		pid, _ := attrs.Get(metricsutil.ProcessPIDKey)
+		return identity, pid.AsString()
 	}
 
 	// Fall back to executable name if pid doesn't exist
 	if exeName, exists := attrs.Get(processExecutableNameKey); exists {
-		return exeName.Str()
+		return exeName.Str(), exeName.Str()
 	}
 
-	return ""
+	return "", ""
 }
@@ -340,6 +340,45 @@ func TestProcessorIdempotency(t *testing.T) {
 	assert.Equal(t, cfg.CriticalAttributeValue, priority.Str())
 }
 
+func TestProcessorTaggingHostmetricsResourceAttributes(t *testing.T) {
+	cfg := &Config{
+		CriticalExecutables:    []string{"kubelet"},
+		PriorityAttributeName:  "nr.priority",
+		CriticalAttributeValue: "critical",
+	}
+	require.NoError(t, cfg.Validate())
+
+	// Shaped like the hostmetrics process scraper's output: the process attributes are on
+	// the resource, the data points only carry metric attributes
+	md := pmetric.NewMetrics()
+	for pid, name := range map[int64]string{1: "kubelet", 2: "bash"} {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutInt("process.pid", pid)
+		rm.Resource().Attributes().PutStr(processExecutableNameKey, name)
+		cpu := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		cpu.SetName("process.cpu.time")
+		dps := cpu.SetEmptySum().DataPoints()
+		for _, state := range []string{"user", "system"} {
+			dps.AppendEmpty().Attributes().PutStr("state", state)
+		}
+	}
+
+	settings := component.TelemetrySettings{Logger: zap.NewNop()}
+	proc, err := newProcessor(cfg, settings.Logger, consumertest.NewNop(), settings)
+	require.NoError(t, err)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	for i := 0; i < md.ResourceMetrics().Len(); i++ {
+		rm := md.ResourceMetrics().At(i)
+		name, _ := rm.Resource().Attributes().Get(processExecutableNameKey)
+		dps := rm.ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints()
+		for l := 0; l < dps.Len(); l++ {
+			_, tagged := dps.At(l).Attributes().Get(cfg.PriorityAttributeName)
+			assert.Equal(t, name.Str() == "kubelet", tagged, "%s data point %d", name.Str(), l)
+		}
+	}
+}
+
 // Helper function to create test metrics with process info
 func createTestMetrics(executableName string, cpuUtil float64, memRSSBytes int64) pmetric.Metrics {
 	md := pmetric.NewMetrics()
@@ -0,0 +1,66 @@
+package reservoirsampler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/processor"
+)
+
+// BenchmarkReservoirSamplerProcessor benchmarks a single batch with different process counts
+func BenchmarkReservoirSamplerProcessor(b *testing.B) {
+	tests := []struct {
+		name          string
+		numProcesses  int
+		reservoirSize int
+	}{
+		{name: "Small", numProcesses: 50, reservoirSize: 10},
+		{name: "Large", numProcesses: 1000, reservoirSize: 100},
+		{name: "XLarge-10k", numProcesses: 10000, reservoirSize: 100},
+	}
+
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		b.Run(tt.name, func(b *testing.B) {
+			cfg := &Config{
+				ReservoirSize:           tt.reservoirSize,
+				IdentityAttributes:      []string{"process.pid"},
+				SampledAttributeName:    "nr.process_sampled_by_reservoir",
+				SampledAttributeValue:   "true",
+				SampleRateAttributeName: "nr.sample_rate",
+				PriorityAttributeName:   "nr.priority",
+				CriticalAttributeValue:  "critical",
+			}
+			require.NoError(b, cfg.Validate())
+
+			// Make the first process critical
+			md := createSamplerTestMetrics(tt.numProcesses, 0, cfg)
+			settings := processor.CreateSettings{
+				ID:                component.NewID(typeStr),
+				TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+				BuildInfo:         component.NewDefaultBuildInfo(),
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				// Keep setup out of the measured time and allocations
+				b.StopTimer()
+				proc, err := newReservoirSamplerProcessor(settings, consumertest.NewNop(), cfg)
+				require.NoError(b, err)
+				mdClone := pmetric.NewMetrics()
+				md.CopyTo(mdClone)
+				b.StartTimer()
+
+				require.NoError(b, proc.ConsumeMetrics(ctx, mdClone))
+			}
+		})
+	}
+}
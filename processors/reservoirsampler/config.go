@@ -15,7 +15,9 @@ type Config struct {
 	SampleRateAttributeName string   `mapstructure:"sample_rate_attribute_name"`
 	PriorityAttributeName   string   `mapstructure:"priority_attribute_name"`
 	CriticalAttributeValue  string   `mapstructure:"critical_attribute_value"`
-	// TopKAttributeName      string   `mapstructure:"topk_attribute_name"`
+	// TopKAttributeName is the attribute set by adaptivetopk in annotate mode. Data points
+	// where it is true are passed through without sampling. Empty disables the check.
+	TopKAttributeName string `mapstructure:"topk_attribute_name"`
 }
 
 var _ component.Config = (*Config)(nil)
@@ -63,6 +65,7 @@ func (cfg *Config) Unmarshal(componentParser *confmap.Conf) error {
 	cfg.SampleRateAttributeName = "nr.sample_rate"
 	cfg.PriorityAttributeName = "nr.priority"
 	cfg.CriticalAttributeValue = "critical"
+	cfg.TopKAttributeName = ""
 
 	return componentParser.Unmarshal(cfg)
 }
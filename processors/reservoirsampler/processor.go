@@ -11,20 +11,25 @@ import (
 	"sync"
 	"time"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/decisions"
 	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/consumer"
-	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/processor"
 	"go.uber.org/zap"
 )
 
+// processPIDKey is the attribute reported to the explain extension as the process's PID.
+const processPIDKey = metricsutil.ProcessPIDKey
+
 type reservoirSamplerProcessor struct {
+	id           component.ID
 	config       *Config
 	logger       *zap.Logger
 	nextConsumer consumer.Metrics
 	obsrep       *reservoirSamplerObsreport
+	recorder     decisions.Recorder // Set in Start when an explain extension is configured
 
 	// Reservoir state
 	mu          sync.Mutex
@@ -43,6 +48,7 @@ func newReservoirSamplerProcessor(settings processor.CreateSettings, next consum
 	rs := rand.NewSource(time.Now().UnixNano())
 
 	return &reservoirSamplerProcessor{
+		id:           settings.ID,
 		config:       cfg,
 		logger:       settings.Logger,
 		nextConsumer: next,
@@ -53,16 +59,30 @@ func newReservoirSamplerProcessor(settings processor.CreateSettings, next consum
 	}, nil
 }
 
-func (p *reservoirSamplerProcessor) Start(_ context.Context, _ component.Host) error { return nil }
-func (p *reservoirSamplerProcessor) Shutdown(_ context.Context) error                { return nil }
+func (p *reservoirSamplerProcessor) Start(_ context.Context, host component.Host) error {
+	p.recorder = decisions.FindRecorder(host)
+	return nil
+}
+
+func (p *reservoirSamplerProcessor) Shutdown(_ context.Context) error { return nil }
 func (p *reservoirSamplerProcessor) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: true}
 }
 
 // generateIdentity creates a unique string for a process based on configured attributes.
-func (p *reservoirSamplerProcessor) generateIdentity(attrs pcommon.Map) (string, bool) {
+// process.pid stands for the process identity among the batch's identities, so that a
+// process reusing the PID of a sampled one does not take over its reservoir slot.
+func (p *reservoirSamplerProcessor) generateIdentity(identities metricsutil.ProcessIdentities, attrs metricsutil.Attributes) (string, bool) {
 	var identityParts []string
 	for _, key := range p.config.IdentityAttributes {
+		if key == processPIDKey {
+			identity, ok := identities.Get(attrs)
+			if !ok {
+				return "", false
+			}
+			identityParts = append(identityParts, key+"="+identity)
+			continue
+		}
 		val, exists := attrs.Get(key)
 		if !exists {
 			return "", false // Cannot form identity if a key is missing
@@ -77,16 +97,46 @@ func (p *reservoirSamplerProcessor) generateIdentity(attrs pcommon.Map) (string,
 	return hex.EncodeToString(h.Sum(nil)), true
 }
 
+// isTopKSelected reports whether adaptivetopk annotated the data point as selected.
+func (p *reservoirSamplerProcessor) isTopKSelected(attrs metricsutil.Attributes) bool {
+	if p.config.TopKAttributeName == "" {
+		return false
+	}
+	topKVal, topKExists := attrs.Get(p.config.TopKAttributeName)
+	return topKExists && topKVal.AsString() == "true"
+}
+
+// recordDecisions reports to the explain extension whether each eligible process of the batch
+// is in the reservoir. Callers must hold p.mu.
+func (p *reservoirSamplerProcessor) recordDecisions(identityPIDs map[string]string) {
+	batch := make([]decisions.Decision, 0, len(identityPIDs))
+	for identity, pid := range identityPIDs {
+		d := decisions.Decision{PID: pid, Outcome: decisions.OutcomeNotSampled, Detail: "identity " + identity[:12]}
+		if p.reservoir[identity] {
+			d.Outcome = decisions.OutcomeSampled
+		}
+		batch = append(batch, d)
+	}
+	p.recorder.RecordDecisions(p.id, batch)
+}
+
 func (p *reservoirSamplerProcessor) ConsumeMetrics(ctx context.Context, md pmetric.Metrics) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	ctx = p.obsrep.StartMetricsOp(ctx)
 	numOriginalMetricPoints := metricsutil.CountPoints(md)
+	// Resolved once per PID, so every data point of a process has the same identity
+	identities := metricsutil.ResolveProcessIdentities(md)
 
 	// First pass: identify eligible DPs and perform sampling logic for their identities
 	// We need to collect all unique eligible identities before modification
 	eligibleIdentities := make(map[string]bool)
+	// PIDs of the eligible identities, only collected for the explain extension
+	var identityPIDs map[string]string
+	if p.recorder != nil {
+		identityPIDs = make(map[string]string)
+	}
 
 	for i := 0; i < md.ResourceMetrics().Len(); i++ {
 		rm := md.ResourceMetrics().At(i)
@@ -106,24 +156,29 @@ func (p *reservoirSamplerProcessor) ConsumeMetrics(ctx context.Context, md pmetr
 
 				for l := 0; l < dps.Len(); l++ {
 					dp := dps.At(l)
-					attrs := dp.Attributes()
+					attrs := metricsutil.Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()}
 
 					// Check if critical (skip critical processes)
 					if prioVal, prioExists := attrs.Get(p.config.PriorityAttributeName); prioExists && prioVal.Str() == p.config.CriticalAttributeValue {
 						continue // Skip critical
 					}
-					// Check if TopK (hypothetical, would skip TopK processes)
-					// if topKVal, topKExists := attrs.Get(p.config.TopKAttributeName); topKExists {
-					//     continue // Skip TopK
-					// }
+					// Check if TopK (skip processes selected by adaptivetopk)
+					if p.isTopKSelected(attrs) {
+						continue // Skip TopK
+					}
 
-					identity, canIdentify := p.generateIdentity(attrs)
+					identity, canIdentify := p.generateIdentity(identities, attrs)
 					if !canIdentify {
 						continue // Cannot sample if identity cannot be formed
 					}
 
 					// Record the eligible identity for sampling
 					eligibleIdentities[identity] = true
+					if identityPIDs != nil {
+						if pidVal, ok := attrs.Get(processPIDKey); ok {
+							identityPIDs[identity] = pidVal.AsString()
+						}
+					}
 				}
 			}
 		}
@@ -164,6 +219,10 @@ func (p *reservoirSamplerProcessor) ConsumeMetrics(ctx context.Context, md pmetr
 		}
 	}
 
+	if p.recorder != nil {
+		p.recordDecisions(identityPIDs)
+	}
+
 	// Update obsreport metrics
 	currentSelectedCount := int64(len(p.reservoir))
 	p.obsrep.recordSelectedIdentitiesCount(ctx, currentSelectedCount)
@@ -181,10 +240,8 @@ func (p *reservoirSamplerProcessor) ConsumeMetrics(ctx context.Context, md pmetr
 	}
 
 	// Second pass: filter metrics (pass through critical & sampled, drop non-sampled eligible)
-	newMd := pmetric.NewMetrics()
-	md.ResourceMetrics().CopyTo(newMd.ResourceMetrics()) // Start with a copy
-
-	newMd.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
+	// Filter in place, MutatesData is declared so the batch is ours to modify
+	md.ResourceMetrics().RemoveIf(func(rm pmetric.ResourceMetrics) bool {
 		rm.ScopeMetrics().RemoveIf(func(sm pmetric.ScopeMetrics) bool {
 			sm.Metrics().RemoveIf(func(metric pmetric.Metric) bool {
 				var dps pmetric.NumberDataPointSlice
@@ -203,26 +260,26 @@ func (p *reservoirSamplerProcessor) ConsumeMetrics(ctx context.Context, md pmetr
 				}
 
 				dps.RemoveIf(func(dp pmetric.NumberDataPoint) bool {
-					attrs := dp.Attributes()
+					attrs := metricsutil.Attributes{Point: dp.Attributes(), Resource: rm.Resource().Attributes()}
 
 					// Priority pass-through (critical processes)
 					if prioVal, prioExists := attrs.Get(p.config.PriorityAttributeName); prioExists && prioVal.Str() == p.config.CriticalAttributeValue {
 						return false // Keep
 					}
-					// TopK pass-through (hypothetical)
-					// if topKVal, topKExists := attrs.Get(p.config.TopKAttributeName); topKExists {
-					//     return false // Keep
-					// }
+					// TopK pass-through (selected by adaptivetopk)
+					if p.isTopKSelected(attrs) {
+						return false // Keep
+					}
 
-					identity, canIdentify := p.generateIdentity(attrs)
+					identity, canIdentify := p.generateIdentity(identities, attrs)
 					if !canIdentify {
 						return true // Drop if cannot identify
 					}
 
 					if p.reservoir[identity] { // Is this identity in our current sample?
 						// Tag it as sampled and add sample rate
-						attrs.PutStr(p.config.SampledAttributeName, p.config.SampledAttributeValue)
-						attrs.PutDouble(p.config.SampleRateAttributeName, sampleRate)
+						attrs.Point.PutStr(p.config.SampledAttributeName, p.config.SampledAttributeValue)
+						attrs.Point.PutDouble(p.config.SampleRateAttributeName, sampleRate)
 						return false // Keep
 					}
 					return true // Drop (eligible but not sampled)
@@ -234,13 +291,13 @@ func (p *reservoirSamplerProcessor) ConsumeMetrics(ctx context.Context, md pmetr
 		return rm.ScopeMetrics().Len() == 0 // Remove resource if all its scopes were removed
 	})
 
-	numProcessedMetricPoints := metricsutil.CountPoints(newMd)
+	numProcessedMetricPoints := metricsutil.CountPoints(md)
 	numDroppedMetricPoints := numOriginalMetricPoints - numProcessedMetricPoints
 	p.obsrep.EndMetricsOp(ctx, p.config.ProcessorType(), numProcessedMetricPoints, numDroppedMetricPoints, nil)
 
-	if newMd.ResourceMetrics().Len() == 0 {
+	if md.ResourceMetrics().Len() == 0 {
 		p.logger.Debug("All metrics were dropped by reservoir sampler, resulting in empty batch.")
 		return nil
 	}
-	return p.nextConsumer.ConsumeMetrics(ctx, newMd)
+	return p.nextConsumer.ConsumeMetrics(ctx, md)
 }
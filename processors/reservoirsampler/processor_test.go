@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/newrelic/nrdot-process-optimization/internal/metricsutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component"
@@ -143,6 +144,112 @@ func TestReservoirSampler_BasicSampling(t *testing.T) {
 	assert.Equal(t, cfg.ReservoirSize, sampledCountMore, "Sampled count after more data should still be reservoir size")
 }
 
+func TestReservoirSampler_IdentitySurvivesOnlyTheSameProcess(t *testing.T) {
+	cfg := &Config{IdentityAttributes: []string{"process.pid"}}
+	proc := &reservoirSamplerProcessor{config: cfg}
+
+	attrs := func(pid, executable string) metricsutil.Attributes {
+		m := pcommon.NewMap()
+		m.PutStr("process.pid", pid)
+		m.PutStr("process.executable.name", executable)
+		return metricsutil.Attributes{Point: m, Resource: pcommon.NewMap()}
+	}
+
+	sampled, ok := proc.generateIdentity(nil, attrs("7", "nginx"))
+	require.True(t, ok)
+	same, _ := proc.generateIdentity(nil, attrs("7", "nginx"))
+	assert.Equal(t, sampled, same)
+
+	// A later process reusing PID 7 must not take over the sampled process's slot
+	reused, _ := proc.generateIdentity(nil, attrs("7", "sh"))
+	assert.NotEqual(t, sampled, reused)
+
+	_, ok = proc.generateIdentity(nil, metricsutil.Attributes{Point: pcommon.NewMap(), Resource: pcommon.NewMap()})
+	assert.False(t, ok)
+}
+
+func TestReservoirSampler_HostmetricsResourceAttributes(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.ReservoirSize = 2
+	require.NoError(t, cfg.Validate())
+
+	// Shaped like the hostmetrics process scraper's output: one resource per process
+	// carrying process.pid, data points carrying only metric attributes
+	md := pmetric.NewMetrics()
+	for pid := int64(1); pid <= 3; pid++ {
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().PutInt("process.pid", pid)
+		rm.Resource().Attributes().PutStr("process.executable.name", fmt.Sprintf("proc-%d", pid))
+		cpu := rm.ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+		cpu.SetName("process.cpu.time")
+		dps := cpu.SetEmptySum().DataPoints()
+		for _, state := range []string{"user", "system"} {
+			dp := dps.AppendEmpty()
+			dp.Attributes().PutStr("state", state)
+			dp.SetDoubleValue(1)
+		}
+	}
+
+	sink := new(consumertest.MetricsSink)
+	proc, err := newReservoirSamplerProcessor(processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+	}, sink, cfg)
+	require.NoError(t, err)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	out := sink.AllMetrics()[0]
+	require.Equal(t, 2, out.ResourceMetrics().Len(), "Two processes should be sampled")
+	for i := 0; i < out.ResourceMetrics().Len(); i++ {
+		dps := out.ResourceMetrics().At(i).ScopeMetrics().At(0).Metrics().At(0).Sum().DataPoints()
+		require.Equal(t, 2, dps.Len(), "A sampled process keeps every data point")
+		assert.True(t, IsSampled(dps.At(0).Attributes(), cfg))
+	}
+}
+
+func TestReservoirSampler_SkipsTopKSelected(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.ReservoirSize = 1
+	cfg.TopKAttributeName = "nr.topk.selected"
+	require.NoError(t, cfg.Validate())
+
+	md := pmetric.NewMetrics()
+	dps := md.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty().SetEmptyGauge().DataPoints()
+	for pid, selected := range map[string]bool{"30": true, "31": false, "32": false} {
+		dp := dps.AppendEmpty()
+		dp.SetDoubleValue(0.5)
+		dp.Attributes().PutStr("process.pid", pid)
+		dp.Attributes().PutBool("nr.topk.selected", selected)
+	}
+
+	sink := new(consumertest.MetricsSink)
+	proc, err := newReservoirSamplerProcessor(processor.CreateSettings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+	}, sink, cfg)
+	require.NoError(t, err)
+	require.NoError(t, proc.ConsumeMetrics(context.Background(), md))
+
+	// The selected process passes through untagged; one of the other two is sampled
+	out := sink.AllMetrics()[0].ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().At(0).Gauge().DataPoints()
+	require.Equal(t, 2, out.Len())
+	sampled := make(map[string]bool)
+	for i := 0; i < out.Len(); i++ {
+		pid, _ := out.At(i).Attributes().Get("process.pid")
+		sampled[pid.Str()] = IsSampled(out.At(i).Attributes(), cfg)
+	}
+	assert.Contains(t, sampled, "30")
+	assert.False(t, sampled["30"], "A top K process is not sampled")
+
+	rate := -1.0
+	for i := 0; i < out.Len(); i++ {
+		if v, ok := out.At(i).Attributes().Get(cfg.SampleRateAttributeName); ok {
+			rate = v.Double()
+		}
+	}
+	assert.Equal(t, 0.5, rate, "Only the two unselected processes are eligible")
+}
+
 func IsCritical(attrs pcommon.Map, cfg *Config) bool {
 	val, exists := attrs.Get(cfg.PriorityAttributeName)
 	return exists && val.Str() == cfg.CriticalAttributeValue